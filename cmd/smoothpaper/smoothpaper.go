@@ -1,11 +1,6 @@
 package main
 
 import (
-	// import image formats to register them
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
-
 	"github.com/matjam/smoothpaper/internal/cli"
 )
 
@@ -0,0 +1,137 @@
+// Package atlas packs the frames of an animated wallpaper into a single
+// image, so that they are uploaded to the GPU once as one texture, and works
+// out which frame to show and where it is in the texture.
+package atlas
+
+import (
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/quad"
+	"github.com/matjam/smoothpaper/internal/resample"
+)
+
+// Atlas is the frames of an animation laid out in a grid, left to right and
+// then top to bottom.
+type Atlas struct {
+	Image                   *image.RGBA // every frame
+	Cols, Rows              int         // the size of the grid
+	FrameWidth, FrameHeight int         // the size of each frame in pixels
+	Start                   time.Time   // when the animation started playing
+
+	delays []time.Duration // how long each frame is shown
+	total  time.Duration   // how long the whole animation takes
+}
+
+// Pack lays out the frames of anim in an atlas no wider or taller than
+// maxSize, scaling the frames down if they do not fit, with 0 meaning there
+// is no limit. Frames shown for less than minDelay are merged, which caps the
+// frame rate without slowing the animation down. The animation starts playing
+// now.
+func Pack(anim *imageformat.Animation, maxSize int, minDelay time.Duration) *Atlas {
+	anim = merge(anim, minDelay)
+	b := anim.Bounds()
+	cols, rows, w, h := layout(len(anim.Frames), b.Dx(), b.Dy(), maxSize)
+	anim = resample.ScaleAnimation(anim, w, h)
+
+	a := &Atlas{
+		Image:       image.NewRGBA(image.Rect(0, 0, cols*w, rows*h)),
+		Cols:        cols,
+		Rows:        rows,
+		FrameWidth:  w,
+		FrameHeight: h,
+		Start:       time.Now(),
+	}
+	for i, frame := range anim.Frames {
+		at := image.Rect(i%cols*w, i/cols*h, (i%cols+1)*w, (i/cols+1)*h)
+		draw.Draw(a.Image, at, frame, frame.Bounds().Min, draw.Src)
+
+		a.delays = append(a.delays, anim.Delays[i])
+		a.total += anim.Delays[i]
+	}
+	return a
+}
+
+// merge returns anim with runs of frames that together are shown for less
+// than minDelay replaced by the first frame of the run, shown for as long as
+// the whole run was, so that the animation takes as long as it did.
+func merge(anim *imageformat.Animation, minDelay time.Duration) *imageformat.Animation {
+	merged := &imageformat.Animation{}
+	var run time.Duration
+	for i, frame := range anim.Frames {
+		if run == 0 {
+			merged.Frames = append(merged.Frames, frame)
+		}
+		run += anim.Delays[i]
+		if run >= minDelay {
+			merged.Delays = append(merged.Delays, run)
+			run = 0
+		}
+	}
+	// the last run is too short for a frame of its own
+	if run > 0 {
+		if n := len(merged.Delays); n > 0 {
+			merged.Frames = merged.Frames[:n]
+			merged.Delays[n-1] += run
+		} else {
+			merged.Delays = append(merged.Delays, run)
+		}
+	}
+	return merged
+}
+
+// layout returns the grid that fits count frames of w x h pixels in an image
+// no larger than maxSize on either side with the least scaling, and the size
+// the frames are scaled to.
+func layout(count, w, h, maxSize int) (cols, rows, fw, fh int) {
+	best := 0.0
+	for c := 1; c <= count; c++ {
+		r := (count + c - 1) / c
+		scale := 1.0
+		if maxSize > 0 {
+			scale = min(1, float64(maxSize)/float64(c*w), float64(maxSize)/float64(r*h))
+		}
+		if scale > best {
+			best, cols, rows = scale, c, r
+		}
+	}
+	return cols, rows, max(1, int(float64(w)*best)), max(1, int(float64(h)*best))
+}
+
+// Frame returns the frame to show at now, looping the animation.
+func (a *Atlas) Frame(now time.Time) int {
+	if a.total <= 0 {
+		return 0
+	}
+	t := now.Sub(a.Start) % a.total
+	for i, delay := range a.delays {
+		if t < delay {
+			return i
+		}
+		t -= delay
+	}
+	return len(a.delays) - 1
+}
+
+// Map moves the texture coordinates of q, which cover a single frame, to the
+// frame to show now. A nil atlas, for a still image, leaves them alone.
+func (a *Atlas) Map(q quad.Quad) quad.Quad {
+	if a == nil {
+		return q
+	}
+	frame := a.Frame(time.Now())
+	aw, ah := float32(a.Image.Rect.Dx()), float32(a.Image.Rect.Dy())
+	cw, ch := float32(a.FrameWidth)/aw, float32(a.FrameHeight)/ah
+	u0, v0 := float32(frame%a.Cols)*cw, float32(frame/a.Cols)*ch
+
+	// keep half a texel away from the edges of the frame, so that linear
+	// filtering does not blend in the neighbouring frames
+	iu, iv := 0.5/aw, 0.5/ah
+	mapU := func(u float32) float32 { return u0 + iu + u*(cw-2*iu) }
+	mapV := func(v float32) float32 { return v0 + iv + v*(ch-2*iv) }
+	q.U1, q.U2 = mapU(q.U1), mapU(q.U2)
+	q.V1, q.V2 = mapV(q.V1), mapV(q.V2)
+	return q
+}
@@ -0,0 +1,57 @@
+package atlas
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/matjam/smoothpaper/internal/imageformat"
+)
+
+// testAnimation returns an animation of 2x2 frames shown for the given
+// delays.
+func testAnimation(delays ...time.Duration) *imageformat.Animation {
+	anim := &imageformat.Animation{Delays: delays}
+	for range delays {
+		anim.Frames = append(anim.Frames, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	}
+	return anim
+}
+
+func TestPackMergesShortFrames(t *testing.T) {
+	tests := []struct {
+		name     string
+		delays   []time.Duration
+		minDelay time.Duration
+		frames   int
+	}{
+		{"no limit", []time.Duration{10, 10, 10}, 0, 3},
+		{"long enough", []time.Duration{50, 40, 60}, 40, 3},
+		{"pairs", []time.Duration{20, 20, 20, 20}, 40, 2},
+		{"short tail", []time.Duration{20, 20, 20, 20, 10}, 40, 2},
+		{"all too short", []time.Duration{10, 10}, 100, 1},
+		{"mixed", []time.Duration{100, 10, 10, 10, 10, 100}, 33, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want time.Duration
+			for i := range tt.delays {
+				tt.delays[i] *= time.Millisecond
+				want += tt.delays[i]
+			}
+			a := Pack(testAnimation(tt.delays...), 0, tt.minDelay*time.Millisecond)
+
+			if a.total != want {
+				t.Errorf("animation takes %v, want %v", a.total, want)
+			}
+			if len(a.delays) != tt.frames {
+				t.Errorf("got %d frames, want %d", len(a.delays), tt.frames)
+			}
+			for i, delay := range a.delays[:len(a.delays)-1] {
+				if delay < tt.minDelay*time.Millisecond {
+					t.Errorf("frame %d is shown for %v, less than %v", i, delay, tt.minDelay*time.Millisecond)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewErrorsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "errors",
+		Short: "List wallpapers that failed to load",
+		Long: `Returns the wallpapers that the daemon failed to load, along with the reason and
+when they will be retried. Failed wallpapers are skipped until then.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			failed, err := ipc.SendErrors()
+			if err != nil {
+				log.Errorf("Error sending command: %v", err)
+				return
+			}
+
+			PrintJSONColored(failed)
+		},
+	}
+}
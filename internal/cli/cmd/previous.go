@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewPreviousCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "previous",
+		Short: "Switch back to the previous wallpaper",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := ipc.SendPrevious(); err != nil {
+				log.Fatalf("Failed to send 'previous' command: %v", err)
+			}
+			log.Info("Previous wallpaper command sent")
+		},
+	}
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewResumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume",
+		Short: "Resume a paused slideshow",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := ipc.SendResume(); err != nil {
+				log.Fatalf("Failed to send 'resume' command: %v", err)
+			}
+			log.Info("Resume command sent")
+		},
+	}
+}
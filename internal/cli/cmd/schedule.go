@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewScheduleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schedule",
+		Short: "Show the schedule rule in effect",
+		Long: `Returns the name of the schedule rule in effect, the wallpapers, delay and fade
+speed it uses, and when the next rule takes over. An empty rule name means the
+global settings apply.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			schedule, err := ipc.SendSchedule()
+			if err != nil {
+				log.Errorf("Error sending command: %v", err)
+				return
+			}
+
+			PrintJSONColored(schedule)
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/cli/cmd/utils"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set [wallpaper.jpg]",
+		Short: "Immediately show a specific wallpaper",
+		Long: `Transitions straight to the given wallpaper without changing the list of
+wallpapers the daemon rotates through. The timer until the next change is restarted.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := filepath.Abs(utils.CanonicalPath(args[0]))
+			if err != nil {
+				log.Fatalf("Invalid wallpaper path: %v", err)
+			}
+			if err := ipc.SendSet(path); err != nil {
+				log.Fatalf("Failed to send 'set' command: %v", err)
+			}
+			log.Infof("Set wallpaper to %v", path)
+		},
+	}
+}
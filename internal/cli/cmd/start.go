@@ -1,18 +1,30 @@
 package cmd
 
 import (
+	"math/rand/v2"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/charmbracelet/log"
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"github.com/matjam/smoothpaper/internal/cli/cmd/utils"
 	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/matjam/smoothpaper/internal/scanner"
+	"github.com/matjam/smoothpaper/internal/schedule"
+	"github.com/matjam/smoothpaper/internal/selection"
+	"github.com/matjam/smoothpaper/internal/solar"
+	"github.com/matjam/smoothpaper/internal/transition"
+	"github.com/matjam/smoothpaper/internal/types"
+	"github.com/matjam/smoothpaper/internal/watcher"
 	"github.com/spf13/viper"
 )
 
+// watchDebounce is how long a new file in a wallpaper directory must go
+// without being written to before it is added to the rotation.
+const watchDebounce = 2 * time.Second
+
 func StartManager() {
 	log.Infof("StartManager() started in PID: %d", os.Getpid())
 
@@ -27,7 +39,6 @@ func StartManager() {
 
 	log.Info("Searching for images ...")
 
-	wallpaperPaths := make([]string, 0)
 	paths := make([]string, 0)
 
 	if !viper.IsSet("wallpapers") {
@@ -53,29 +64,70 @@ func StartManager() {
 
 	log.Infof("Wallpaper directories: %v", paths)
 
-	for _, path := range paths {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			log.Fatalf("Wallpaper directory does not exist: %s", path)
-		}
+	outputs := make(map[string]ipc.OutputConfig)
+	if err := viper.UnmarshalKey("outputs", &outputs); err != nil {
+		log.Fatalf("Invalid outputs configuration: %v", err)
+	}
 
-		dirEntries, err := os.ReadDir(path)
-		if err != nil {
-			log.Fatalf("Error reading wallpapers directory: %v", err)
+	// the directories of each output are scanned and watched along with the
+	// global ones
+	roots := slices.Clone(paths)
+	for name, output := range outputs {
+		for i, dir := range output.Wallpapers {
+			output.Wallpapers[i] = utils.CanonicalPath(dir)
+			if !slices.Contains(roots, output.Wallpapers[i]) {
+				roots = append(roots, output.Wallpapers[i])
+			}
+		}
+		if len(output.Wallpapers) > 0 {
+			log.Infof("Wallpaper directories for %v: %v", name, output.Wallpapers)
 		}
+	}
+
+	// and so are those of each schedule rule
+	var rules []schedule.Rule
+	if err := viper.UnmarshalKey("schedule", &rules); err != nil {
+		log.Fatalf("Invalid schedule configuration: %v", err)
+	}
+	s, err := scanner.New(scannerOptions())
+	if err != nil {
+		log.Fatalf("Invalid wallpaper scan configuration: %v", err)
+	}
 
-		for _, entry := range dirEntries {
-			if entry.IsDir() {
-				continue
+	for i, rule := range rules {
+		for j, dir := range rule.Wallpapers {
+			rule.Wallpapers[j] = utils.CanonicalPath(dir)
+			if !slices.Contains(roots, rule.Wallpapers[j]) {
+				roots = append(roots, rule.Wallpapers[j])
 			}
-			name := strings.ToLower(entry.Name())
-			if strings.HasSuffix(name, ".png") ||
-				strings.HasSuffix(name, ".jpg") ||
-				strings.HasSuffix(name, ".jpeg") ||
-				strings.HasSuffix(name, ".gif") {
-				wallpaperPaths = append(wallpaperPaths, filepath.Join(path, entry.Name()))
+		}
+		// the frames of a time-lapse are shown in order rather than rotated,
+		// so they are not added to the wallpapers, and the manager leaves
+		// them out of the rotation if a wallpaper directory holds them too
+		if rule.Timelapse != "" {
+			rules[i].Timelapse = utils.CanonicalPath(rule.Timelapse)
+			if rules[i].Frames, err = s.Scan(rules[i].Timelapse); err != nil {
+				log.Fatalf("Error searching for time-lapse frames: %v", err)
 			}
 		}
 	}
+	sched, err := schedule.New(rules, solarLocation(), time.Now)
+	if err != nil {
+		log.Fatalf("Invalid schedule configuration: %v", err)
+	}
+
+	wallpaperPaths, scannedDirs, err := s.ScanTree(roots...)
+	if err != nil {
+		log.Fatalf("Error searching for wallpapers: %v", err)
+	}
+
+	// directories may lie inside one another, so drop files found twice
+	seen := make(map[string]bool, len(wallpaperPaths))
+	wallpaperPaths = slices.DeleteFunc(wallpaperPaths, func(path string) bool {
+		dup := seen[path]
+		seen[path] = true
+		return dup
+	})
 
 	if len(wallpaperPaths) == 0 {
 		log.Fatal("No valid wallpapers found in the specified directories.")
@@ -83,11 +135,37 @@ func StartManager() {
 
 	log.Infof("Found %d wallpapers in %s", len(wallpaperPaths), viper.GetString("wallpapers"))
 	log.Infof("First wallpaper: %s", wallpaperPaths[0])
-	log.Infof("Shuffle: %v", viper.GetBool("shuffle"))
 
-	manager := ipc.NewManager(wallpaperPaths)
-	if viper.GetBool("shuffle") {
-		manager.Shuffle()
+	loaded, err := transition.LoadShaders(utils.CanonicalPath(viper.GetString("transitions_dir")))
+	if err != nil {
+		log.Errorf("Failed to load transitions: %v", err)
+	}
+	if len(loaded) > 0 {
+		log.Infof("Loaded transitions: %v", loaded)
+	}
+
+	manager := ipc.NewManager(wallpaperPaths, paths, outputs, sched, selectionStrategy())
+	if !viper.GetBool("restore_state") || !manager.RestoreState() {
+		manager.Arrange()
+	}
+
+	if viper.GetBool("watch") {
+		w, err := watcher.New(s, watchDebounce, roots, scannedDirs)
+		if err != nil {
+			log.Errorf("Failed to watch wallpaper directories: %v", err)
+		} else {
+			defer w.Close()
+			go w.Run(
+				func(added []string) {
+					log.Infof("New wallpapers found: %v", added)
+					manager.EnqueueCommand(ipc.Command{Type: ipc.CommandAdd, Args: added})
+				},
+				func(removed []string) {
+					log.Infof("Wallpapers removed: %v", removed)
+					manager.EnqueueCommand(ipc.Command{Type: ipc.CommandRemove, Args: removed})
+				},
+			)
+		}
 	}
 
 	go func() {
@@ -106,6 +184,63 @@ func StartManager() {
 	log.Infof("smoothpaper exited")
 }
 
+// solarLocation reads where the sun is followed from for schedules, or
+// returns nil if latitude and longitude are not set.
+func solarLocation() *solar.Location {
+	if !viper.IsSet("latitude") && !viper.IsSet("longitude") {
+		return nil
+	}
+	loc := &solar.Location{
+		Latitude:  viper.GetFloat64("latitude"),
+		Longitude: viper.GetFloat64("longitude"),
+	}
+	if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+		log.Fatalf("Invalid location: latitude must be from -90 to 90 and longitude from -180 to 180, not %v, %v", loc.Latitude, loc.Longitude)
+	}
+	return loc
+}
+
+// selectionStrategy builds the strategy that decides the order of wallpapers.
+// Without a selection setting, the shuffle setting chooses between shuffling
+// once and the order the files are found in.
+func selectionStrategy() selection.Strategy {
+	name := types.Selection(viper.GetString("selection"))
+	if name == "" {
+		name = types.SelectionSequential
+		if viper.GetBool("shuffle") {
+			name = types.SelectionShuffle
+		}
+	}
+	log.Infof("Selection: %v", name)
+
+	var weights []selection.Weight
+	if err := viper.UnmarshalKey("weights", &weights); err != nil {
+		log.Fatalf("Invalid weights configuration: %v", err)
+	}
+	for i := range weights {
+		weights[i].Path = utils.CanonicalPath(weights[i].Path)
+	}
+
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	strategy, err := selection.New(name, weights, rng)
+	if err != nil {
+		log.Warnf("Invalid selection: %v; shuffling instead", err)
+		strategy, _ = selection.New(types.SelectionShuffle, nil, rng)
+	}
+	return strategy
+}
+
+// scannerOptions builds the wallpaper discovery options from the configuration.
+func scannerOptions() scanner.Options {
+	return scanner.Options{
+		Recursive:      viper.GetBool("recursive"),
+		Include:        viper.GetStringSlice("include"),
+		Exclude:        viper.GetStringSlice("exclude"),
+		FollowSymlinks: viper.GetBool("follow_symlinks"),
+		Hidden:         viper.GetBool("hidden_files"),
+	}
+}
+
 func setupRotatingLogger() {
 	home := os.Getenv("HOME")
 	logDir := filepath.Join(home, ".local", "share", "smoothpaper")
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+func NewToggleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "toggle",
+		Short: "Pause or resume the slideshow timer",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := ipc.SendToggle(); err != nil {
+				log.Fatalf("Failed to send 'toggle' command: %v", err)
+			}
+			log.Info("Toggle command sent")
+		},
+	}
+}
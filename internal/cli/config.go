@@ -20,12 +20,34 @@ func InitConfig() {
 	}
 
 	viper.SetDefault("wallpapers", "~/Pictures/wallpapers")
+	viper.SetDefault("recursive", false)
+	viper.SetDefault("include", []string{})
+	viper.SetDefault("exclude", []string{})
+	viper.SetDefault("follow_symlinks", true)
+	viper.SetDefault("hidden_files", false)
+	viper.SetDefault("watch", true)
 	viper.SetDefault("shuffle", true)
+	viper.SetDefault("selection", "")
+	viper.SetDefault("restore_state", true)
 	viper.SetDefault("scale_mode", "vertical")
+	viper.SetDefault("letterbox_color", "#000000")
+	viper.SetDefault("output_mode", "same")
+	viper.SetDefault("span_gap", 0)
 	viper.SetDefault("easing", "ease-in-out")
+	viper.SetDefault("transition", "fade")
+	viper.SetDefault("transitions_dir", "~/.config/smoothpaper/transitions")
+	viper.SetDefault("ken_burns", false)
+	viper.SetDefault("ken_burns_zoom", 1.2)
+	viper.SetDefault("ken_burns_random", true)
 	viper.SetDefault("fade_speed", 1.0)
 	viper.SetDefault("delay", 300)
+	viper.SetDefault("retry_failed", 600)
 	viper.SetDefault("framerate_limit", 60)
+	viper.SetDefault("animation_framerate_limit", 30)
+	viper.SetDefault("on_disconnect", "reconnect")
+	viper.SetDefault("reconnect_timeout", 0)
+	viper.SetDefault("prefetch", 1)
+	viper.SetDefault("prefetch_memory", 512)
 	viper.SetDefault("debug", false)
 
 	viper.AutomaticEnv() // read environment variables that match
@@ -33,10 +33,17 @@ var rootCmd = &cobra.Command{
 	Once running, smoothpaper exposes a local UNIX domain socket API for control. You can
 	send commands such as:
 	
-	  • status — check if the daemon is running and inspect the current wallpaper
-	  • next   — immediately transition to the next wallpaper
-	  • stop   — gracefully shut down the background daemon
-	  • load   — load a new list of wallpaper file paths
+	  • status   — check if the daemon is running and inspect the current wallpaper
+	  • errors   — list wallpapers that failed to load and are being skipped
+	  • schedule — show the schedule rule in effect and when the next one starts
+	  • next     — immediately transition to the next wallpaper
+	  • previous — transition back to the previously shown wallpaper
+	  • stop     — gracefully shut down the background daemon
+	  • load     — load a new list of wallpaper file paths
+	  • set      — immediately show a specific wallpaper file
+	  • pause    — pause the slideshow timer, keeping the current wallpaper
+	  • resume   — resume a paused slideshow where it left off
+	  • toggle   — pause or resume the slideshow
 	
 	Wallpapers are shuffled by default (unless configured otherwise), and transitions can
 	be customized via the configuration file.
@@ -148,9 +155,16 @@ func Execute() {
 
 	// Register subcommands
 	rootCmd.AddCommand(cmd.NewStatusCmd())
+	rootCmd.AddCommand(cmd.NewErrorsCmd())
+	rootCmd.AddCommand(cmd.NewScheduleCmd())
 	rootCmd.AddCommand(cmd.NewNextCmd())
+	rootCmd.AddCommand(cmd.NewPreviousCmd())
 	rootCmd.AddCommand(cmd.NewStopCmd())
 	rootCmd.AddCommand(cmd.NewLoadCmd())
+	rootCmd.AddCommand(cmd.NewSetCmd())
+	rootCmd.AddCommand(cmd.NewPauseCmd())
+	rootCmd.AddCommand(cmd.NewResumeCmd())
+	rootCmd.AddCommand(cmd.NewToggleCmd())
 	rootCmd.AddCommand(cmd.NewGenManCmd(rootCmd))
 
 	// Initialize configuration before command execution
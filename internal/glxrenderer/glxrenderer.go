@@ -1,21 +1,30 @@
 package glxrenderer
 
 /*
-#cgo LDFLAGS: -lGL -lX11 -lXrender -lva-glx
+#cgo LDFLAGS: -lGL -lX11 -lXrender -lXrandr -lva-glx
 #include "glxrenderer.h"
 */
 import "C"
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"runtime"
+	"slices"
 	"time"
 	"unsafe"
 
 	"github.com/charmbracelet/log"
 	"github.com/go-gl/gl/v2.1/gl"
+	"github.com/matjam/smoothpaper/internal/atlas"
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/kenburns"
+	"github.com/matjam/smoothpaper/internal/quad"
+	"github.com/matjam/smoothpaper/internal/resample"
+	"github.com/matjam/smoothpaper/internal/transition"
 	"github.com/matjam/smoothpaper/internal/types"
 )
 
@@ -28,6 +37,11 @@ type GLXRenderer struct {
 	width   int          // Width of the window in pixels
 	height  int          // Height of the window in pixels
 
+	monitors       []monitor // The monitors, each drawn in its own viewport of the window
+	spanGap        int       // Pixels of the image hidden between neighbouring monitors when spanning
+	randrEventBase C.int     // First RandR event number, or -1 without RandR
+	pixmapStale    bool      // Whether the root pixmap needs setting again after a screen change
+
 	texA texture // Primary texture (the currently displayed image)
 	texB texture // Secondary texture (used for transitioning)
 
@@ -36,20 +50,58 @@ type GLXRenderer struct {
 	fading   bool          // Whether a transition is currently in progress
 
 	scaleMode  types.ScalingMode // How images should scale (stretch, fit, center, etc.)
+	letterbox  color.RGBA        // The color of the bars around images that do not fill a monitor
 	easingMode types.EasingMode  // The easing function to apply to alpha blending
+	transition types.Transition  // The configured transition, which may be random
+	active     types.Transition  // The transition in progress, or the last one used
+	kenBurns   kenburns.Config   // How images pan and zoom while they are shown
 	framerate  int               // Frame rate to maintain during rendering
+
+	minFrameDelay time.Duration // The shortest time a frame of an animated image is shown, capping its frame rate
+
+	maxTextureSize int // GL_MAX_TEXTURE_SIZE, the largest texture the GPU accepts
+
+	current image.Image // The image last shown, uploaded again after reconnecting
+
+	transitionPrograms map[types.Transition]*transitionProgram // Compiled shader transitions; nil if one failed to compile
+	fromCapture        texture                                 // The window showing texA, for shader transitions
+	toCapture          texture                                 // The window showing texB, for shader transitions
 }
 
 // NewRenderer initializes the GLX context, creates a fullscreen override-redirect X11 window,
 // and binds it to an OpenGL context so we can start rendering.
-func NewRenderer(scale types.ScalingMode, easing types.EasingMode, framerate int) (*GLXRenderer, error) {
+func NewRenderer(scale types.ScalingMode, letterbox color.RGBA, easing types.EasingMode, trans types.Transition, kb kenburns.Config, framerate int, animationFramerate int, spanGap int) (*GLXRenderer, error) {
 	runtime.LockOSThread() // Required: OpenGL contexts must be accessed from a single OS thread
 
+	r := &GLXRenderer{
+		scaleMode:          scale,
+		letterbox:          letterbox,
+		easingMode:         easing,
+		transition:         trans,
+		kenBurns:           kb,
+		framerate:          framerate,
+		spanGap:            spanGap,
+		transitionPrograms: make(map[types.Transition]*transitionProgram),
+	}
+	if animationFramerate > 0 {
+		r.minFrameDelay = time.Second / time.Duration(animationFramerate)
+	}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// connect opens the X11 display and creates the window and GLX context that we
+// render into. On failure nothing is left open.
+func (r *GLXRenderer) connect() error {
 	dpy := C.open_display() // Calls XOpenDisplay(NULL), connects to X11 server using DISPLAY env var
 	if dpy == nil {
-		return nil, fmt.Errorf("unable to open X11 display")
+		return fmt.Errorf("unable to open X11 display")
 	}
-	C.set_io_error_handler() // Prevents crashing if display disappears
+	C.set_io_error_handler()         // Prevents crashing if display disappears
+	C.set_io_error_exit_handler(dpy) // ... and keeps Xlib from exiting so we can reconnect
+	C.reset_display_gone()
 
 	screen := C.XDefaultScreen(dpy) // Returns the default screen index for the display
 	width := int(C.get_display_width(dpy, screen))
@@ -60,29 +112,149 @@ func NewRenderer(scale types.ScalingMode, easing types.EasingMode, framerate int
 	attribs := []C.int{C.GLX_RGBA, C.GLX_DEPTH_SIZE, 24, C.GLX_DOUBLEBUFFER, 0}
 	vi := C.glXChooseVisual(dpy, screen, &attribs[0]) // Finds an appropriate visual configuration
 	if vi == nil {
-		return nil, fmt.Errorf("no suitable visual")
+		C.XDestroyWindow(dpy, win)
+		C.XCloseDisplay(dpy)
+		return fmt.Errorf("no suitable visual")
 	}
 
 	ctx := C.glXCreateContext(dpy, vi, nil, C.True) // Creates an OpenGL context associated with the visual
-	C.glXMakeCurrent(dpy, C.GLXDrawable(win), ctx)  // Makes this OpenGL context current to the created window
+	C.XFree(unsafe.Pointer(vi))
+	C.glXMakeCurrent(dpy, C.GLXDrawable(win), ctx) // Makes this OpenGL context current to the created window
 
 	// Initialize Go-side OpenGL bindings
 	if err := gl.Init(); err != nil {
-		return nil, fmt.Errorf("opengl init failed: %w", err)
+		C.glXMakeCurrent(dpy, 0, nil)
+		C.glXDestroyContext(dpy, ctx)
+		C.XDestroyWindow(dpy, win)
+		C.XCloseDisplay(dpy)
+		return fmt.Errorf("opengl init failed: %w", err)
 	}
 	gl.Viewport(0, 0, int32(width), int32(height)) // Sets up the viewport to match the window size
-	gl.ClearColor(0.0, 0.0, 0.0, 1.0)              // Default clear color is opaque black
+	// Bars around images and empty monitors show the letterbox color
+	gl.ClearColor(float32(r.letterbox.R)/255, float32(r.letterbox.G)/255, float32(r.letterbox.B)/255, 1.0)
+
+	var maxTextureSize int32
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &maxTextureSize) // Largest texture dimension the GPU supports
+
+	r.display = dpy
+	r.window = win
+	r.context = ctx
+	r.width = width
+	r.height = height
+	r.randrEventBase = C.select_screen_change(dpy, screen) // Tells us when monitors change
+	r.maxTextureSize = int(maxTextureSize)
+	if r.randrEventBase < 0 {
+		log.Warn("XRandR is not available, treating the screen as a single monitor")
+	}
+	r.monitors = r.queryMonitors()
+	return nil
+}
+
+// teardown releases the textures, GLX context, window and display connection.
+// If the X server has gone away, those went with it and only the memory Xlib
+// holds for the connection is freed.
+func (r *GLXRenderer) teardown() {
+	if r.display == nil {
+		return
+	}
+	if r.IsDisplayRunning() {
+		deleteTexture(&r.texA)
+		deleteTexture(&r.texB)
+		deleteTexture(&r.fromCapture)
+		deleteTexture(&r.toCapture)
+		for _, p := range r.transitionPrograms {
+			if p != nil {
+				gl.DeleteProgram(p.program)
+			}
+		}
+		C.glXMakeCurrent(r.display, 0, nil)
+		C.glXDestroyContext(r.display, r.context)
+		C.XDestroyWindow(r.display, r.window)
+	}
+	C.XCloseDisplay(r.display)
 
-	return &GLXRenderer{
-		display:    dpy,
-		window:     win,
-		context:    ctx,
-		width:      width,
-		height:     height,
-		scaleMode:  scale,
-		easingMode: easing,
-		framerate:  framerate,
-	}, nil
+	r.display = nil
+	r.context = nil
+	r.texA = texture{}
+	r.texB = texture{}
+	r.fromCapture = texture{}
+	r.toCapture = texture{}
+	clear(r.transitionPrograms)
+	r.fading = false
+}
+
+// monitor is the part of the window that one monitor shows, in X coordinates
+// with the origin at the top left. When the image is spanned across monitors
+// with a gap between them, span is the part of the layout the monitor shows.
+type monitor struct {
+	name          string
+	x, y          int
+	width, height int
+	span          spanView
+}
+
+// maxMonitors is the most monitors that are asked for from XRandR.
+const maxMonitors = 16
+
+// queryMonitors asks XRandR which monitors are switched on and where they are.
+// Monitors that mirror another are only drawn once, and without XRandR the
+// whole window is treated as one monitor.
+func (r *GLXRenderer) queryMonitors() []monitor {
+	var infos [maxMonitors]C.monitor_info
+	var monitors []monitor
+	if r.randrEventBase >= 0 {
+		n := int(C.get_monitors(r.display, C.XDefaultScreen(r.display), &infos[0], maxMonitors))
+		for _, info := range infos[:n] {
+			m := monitor{
+				name:   C.GoString(&info.name[0]),
+				x:      int(info.x),
+				y:      int(info.y),
+				width:  int(info.width),
+				height: int(info.height),
+			}
+			mirrored := slices.ContainsFunc(monitors, func(o monitor) bool {
+				return o.x == m.x && o.y == m.y && o.width == m.width && o.height == m.height
+			})
+			if !mirrored {
+				monitors = append(monitors, m)
+			}
+		}
+	}
+	if len(monitors) == 0 {
+		monitors = []monitor{{name: "screen", width: r.width, height: r.height}}
+	}
+
+	for _, m := range monitors {
+		log.Infof("Monitor %v: %vx%v at %v,%v", m.name, m.width, m.height, m.x, m.y)
+	}
+	return monitors
+}
+
+// screenChanged resizes the window to the new size of the screen and finds
+// where the monitors are now, after one was plugged in, unplugged or rotated.
+func (r *GLXRenderer) screenChanged() {
+	screen := C.XDefaultScreen(r.display)
+	r.width = int(C.get_display_width(r.display, screen))
+	r.height = int(C.get_display_height(r.display, screen))
+	log.Infof("Screen configuration changed, now %vx%v", r.width, r.height)
+
+	C.XResizeWindow(r.display, r.window, C.uint(r.width), C.uint(r.height))
+	r.monitors = r.queryMonitors()
+	r.pixmapStale = true
+}
+
+// viewports returns the parts of the window the image is drawn in: one for
+// each monitor, or the whole window when the image is spanned across them.
+// With a span gap, each monitor shows its own part of the spanned image.
+func (r *GLXRenderer) viewports() []monitor {
+	if r.scaleMode == types.ScalingModeSpan {
+		if r.spanGap > 0 && len(r.monitors) > 1 {
+			spanned, _, _ := spanLayout(r.monitors, r.spanGap)
+			return spanned
+		}
+		return []monitor{{width: r.width, height: r.height}}
+	}
+	return r.monitors
 }
 
 // SetRootPixmap reads pixels from the OpenGL backbuffer, flips vertically, and sets the root pixmap
@@ -104,16 +276,30 @@ func (r *GLXRenderer) SetRootPixmap() {
 	C.set_root_pixmap(r.display, C.XDefaultScreen(r.display), (*C.uchar)(unsafe.Pointer(&flipped[0])), C.int(w), C.int(h))
 }
 
-// GetSize returns the dimensions of the rendering window.
+// GetSize returns the dimensions of the largest monitor, or of the whole
+// window when the image is spanned across the monitors, gaps included.
 func (r *GLXRenderer) GetSize() (int, int) {
-	return r.width, r.height
+	if r.scaleMode == types.ScalingModeSpan && r.spanGap > 0 && len(r.monitors) > 1 {
+		_, w, h := spanLayout(r.monitors, r.spanGap)
+		return w, h
+	}
+	w, h := 0, 0
+	for _, vp := range r.viewports() {
+		w, h = max(w, vp.width), max(h, vp.height)
+	}
+	return w, h
+}
+
+// MaxTextureSize returns the largest texture width or height the GPU accepts.
+func (r *GLXRenderer) MaxTextureSize() int {
+	return r.maxTextureSize
 }
 
 // SetImage loads a new image into texA. Any existing texture is deleted first.
 func (r *GLXRenderer) SetImage(img image.Image) error {
-	if r.texA.id != 0 {
-		gl.DeleteTextures(1, &r.texA.id)
-	}
+	r.current = img
+
+	deleteTexture(&r.texA)
 	t, err := r.createTexture(img) // Converts Go image to OpenGL texture
 	if err != nil {
 		return err
@@ -135,14 +321,16 @@ func (r *GLXRenderer) Transition(next image.Image, duration time.Duration) error
 
 	}
 
-	if r.texB.id != 0 {
-		gl.DeleteTextures(1, &r.texB.id)
-	}
+	deleteTexture(&r.texB)
 	t, err := r.createTexture(next)
 	if err != nil {
 		return err
 	}
+	r.current = next
 	r.texB = t
+	r.active = transition.Pick(r.transition, r.active)
+	deleteTexture(&r.fromCapture)
+	deleteTexture(&r.toCapture)
 	r.start = time.Now()
 	r.duration = duration
 	r.fading = true
@@ -161,9 +349,22 @@ func (r *GLXRenderer) Transition(next image.Image, duration time.Duration) error
 	return nil
 }
 
+// Animating reports whether what is shown moves between changes, panning and
+// zooming or playing an animated image, so Render must be called every frame.
+func (r *GLXRenderer) Animating() bool {
+	return r.kenBurns.Enabled || r.texA.atlas != nil || r.texB.atlas != nil
+}
+
 // Render the current image; this blocks for the given frame rate. Ideally, you do not
 // need to call this directly, as it is called in a loop by the renderer during Transition.
 func (r *GLXRenderer) Render() error {
+	if !r.IsDisplayRunning() {
+		return fmt.Errorf("display connection lost")
+	}
+	if C.process_events(r.display, r.randrEventBase) != 0 {
+		r.screenChanged()
+	}
+
 	alpha := float32(1.0)
 	if r.fading {
 		t := float32(time.Since(r.start).Seconds() / r.duration.Seconds())
@@ -171,11 +372,10 @@ func (r *GLXRenderer) Render() error {
 			t = 1.0
 			deleteTexture(&r.texA)
 			r.texA = r.texB
+			r.texB = texture{}
 
-			r.texB.id = 0
-			r.texB.width = 0
-			r.texB.height = 0
-
+			deleteTexture(&r.fromCapture)
+			deleteTexture(&r.toCapture)
 			r.fading = false
 		}
 		alpha = applyEasing(r.easingMode, t)
@@ -183,6 +383,11 @@ func (r *GLXRenderer) Render() error {
 
 	if !r.fading {
 		r.renderStatic(r.texA)
+		if r.pixmapStale && r.texA.id != 0 {
+			// the backbuffer now matches the new layout
+			r.SetRootPixmap()
+			r.pixmapStale = false
+		}
 	} else {
 		r.renderFade(alpha, r.texA, r.texB)
 	}
@@ -195,21 +400,49 @@ func (r *GLXRenderer) Render() error {
 
 // texture holds an OpenGL texture ID and its size.
 type texture struct {
-	id     uint32
-	width  int
-	height int
+	id       uint32
+	width    int
+	height   int
+	motion   kenburns.Motion // The pan and zoom across the image while it is shown
+	backdrop uint32          // A blurred copy drawn behind the image by the fit-blur scale mode, or 0
+	atlas    *atlas.Atlas    // The frames of an animated image, which the texture holds, or nil
+}
+
+// SetMotionPeriod sets how long the pan and zoom of the images shown from now
+// on lasts.
+func (r *GLXRenderer) SetMotionPeriod(period time.Duration) {
+	r.kenBurns.Period = period
 }
 
 // createTexture takes a Go image.Image and turns it into an OpenGL texture.
 func (r *GLXRenderer) createTexture(img image.Image) (texture, error) {
 	var tex texture
+	original := img
+	if anim, ok := img.(*imageformat.Animation); ok {
+		// every frame goes into the one texture
+		tex.atlas = atlas.Pack(anim, r.maxTextureSize, r.minFrameDelay)
+		img = tex.atlas.Image
+	}
 	bounds := img.Bounds()
+
+	// Never upload a texture larger than the GPU supports
+	if w, h := resample.Limit(bounds.Dx(), bounds.Dy(), r.maxTextureSize); w != bounds.Dx() || h != bounds.Dy() {
+		log.Warnf("image is %vx%v, scaling to %vx%v to fit the maximum texture size", bounds.Dx(), bounds.Dy(), w, h)
+		img = resample.Scale(img, w, h)
+		bounds = img.Bounds()
+	}
+
 	tex.width = bounds.Dx()
 	tex.height = bounds.Dy()
-
-	// Convert to RGBA (required format for OpenGL upload)
-	rgba := image.NewRGBA(bounds)
-	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	tex.motion = r.kenBurns.Start()
+
+	// Convert to RGBA (required format for OpenGL upload), unless the image was
+	// already decoded into one ahead of time
+	rgba, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, tex.width, tex.height))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	}
 
 	// Generate and bind OpenGL texture ID
 	gl.GenTextures(1, &tex.id)
@@ -218,7 +451,12 @@ func (r *GLXRenderer) createTexture(img image.Image) (texture, error) {
 	// Set texture parameters
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	if tex.atlas != nil {
+		// smaller mipmap levels would blend neighbouring frames together
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	} else {
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	}
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 
 	// Upload pixel data to GPU
@@ -226,21 +464,44 @@ func (r *GLXRenderer) createTexture(img image.Image) (texture, error) {
 		int32(tex.width), int32(tex.height), 0,
 		gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
 
-	gl.GenerateMipmap(gl.TEXTURE_2D) // Create mipmaps for smoother scaling
+	if tex.atlas != nil {
+		// the image is laid out in the size of a single frame
+		tex.width, tex.height = tex.atlas.FrameWidth, tex.atlas.FrameHeight
+	} else {
+		gl.GenerateMipmap(gl.TEXTURE_2D) // Create mipmaps for smoother scaling
+	}
+
+	if r.scaleMode == types.ScalingModeFitBlur {
+		tex.backdrop = createBackdrop(original)
+	}
 	return tex, nil
 }
 
+// backdropSize is the longest side of the blurred copy of an image drawn
+// behind it by the fit-blur scale mode. The smaller it is, the blurrier.
+const backdropSize = 48
+
+// createBackdrop uploads a small, blurred copy of img, which linear filtering
+// keeps soft when it is scaled up.
+func createBackdrop(img image.Image) uint32 {
+	blurred := resample.Backdrop(img, backdropSize)
+
+	var id uint32
+	gl.GenTextures(1, &id)
+	gl.BindTexture(gl.TEXTURE_2D, id)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA,
+		int32(blurred.Rect.Dx()), int32(blurred.Rect.Dy()), 0,
+		gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(blurred.Pix))
+	return id
+}
+
 func (r *GLXRenderer) Cleanup() {
-	if r.texA.id != 0 {
-		gl.DeleteTextures(1, &r.texA.id)
-	}
-	if r.texB.id != 0 {
-		gl.DeleteTextures(1, &r.texB.id)
-	}
-	C.glXMakeCurrent(r.display, 0, nil)
-	C.glXDestroyContext(r.display, r.context)
-	C.XDestroyWindow(r.display, r.window)
-	C.XCloseDisplay(r.display)
+	r.teardown()
+	r.current = nil
 }
 
 func applyEasing(mode types.EasingMode, t float32) float32 {
@@ -263,24 +524,226 @@ func applyEasing(mode types.EasingMode, t float32) float32 {
 }
 
 func (r *GLXRenderer) renderFade(alpha float32, texA, texB texture) {
+	frame := transition.At(r.active, alpha)
+	if frame.Shader {
+		if r.renderShader(alpha, texA, texB) {
+			return
+		}
+		// the shader did not compile, so this change fades instead
+		r.active = types.TransitionFade
+		frame = transition.At(r.active, alpha)
+	}
+	if !frame.Fade {
+		r.renderMove(frame, texA, texB)
+		return
+	}
+
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	gl.Enable(gl.BLEND)
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
 	gl.Enable(gl.TEXTURE_2D)
 
-	if texA.id != 0 && alpha < 1.0 {
-		gl.Color4f(1, 1, 1, 1.0-alpha)
-		gl.BindTexture(gl.TEXTURE_2D, texA.id)
-		r.drawCenteredQuad(texA)
-	}
-	if texB.id != 0 {
-		gl.Color4f(1, 1, 1, alpha)
-		gl.BindTexture(gl.TEXTURE_2D, texB.id)
-		r.drawCenteredQuad(texB)
+	for _, vp := range r.viewports() {
+		r.setViewport(vp)
+		if texA.id != 0 && alpha < 1.0 {
+			gl.Color4f(1, 1, 1, 1.0-alpha)
+			gl.BindTexture(gl.TEXTURE_2D, texA.id)
+			r.drawCenteredQuad(texA, vp)
+		}
+		if texB.id != 0 {
+			gl.Color4f(1, 1, 1, alpha)
+			gl.BindTexture(gl.TEXTURE_2D, texB.id)
+			r.drawCenteredQuad(texB, vp)
+		}
 	}
 
 	gl.Disable(gl.BLEND)
 }
+
+// renderMove draws a frame of a slide, push or wipe, where the images move or
+// are uncovered rather than blended. The incoming image covers the outgoing
+// one, bars and all, within the part of each monitor it has reached.
+func (r *GLXRenderer) renderMove(frame transition.Frame, texA, texB texture) {
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	gl.Color4f(1, 1, 1, 1)
+
+	for _, vp := range r.viewports() {
+		r.setViewport(vp)
+		if texA.id != 0 {
+			gl.Enable(gl.TEXTURE_2D)
+			gl.BindTexture(gl.TEXTURE_2D, texA.id)
+			r.drawShifted(texA, vp, frame.From)
+		}
+
+		x, y, w, h := frame.Clip.Pixels(vp.width, vp.height)
+		gl.Enable(gl.SCISSOR_TEST)
+		gl.Scissor(int32(vp.x)+x, int32(r.height-vp.y-vp.height)+y, w, h)
+
+		gl.Disable(gl.TEXTURE_2D)
+		gl.Color4f(float32(r.letterbox.R)/255, float32(r.letterbox.G)/255, float32(r.letterbox.B)/255, 1)
+		r.drawShifted(texture{}, vp, frame.To)
+		gl.Color4f(1, 1, 1, 1)
+
+		if texB.id != 0 {
+			gl.Enable(gl.TEXTURE_2D)
+			gl.BindTexture(gl.TEXTURE_2D, texB.id)
+			r.drawShifted(texB, vp, frame.To)
+		}
+		gl.Disable(gl.SCISSOR_TEST)
+	}
+}
+
+// transitionProgram is a compiled shader transition.
+type transitionProgram struct {
+	program  uint32
+	from     int32
+	to       int32
+	progress int32
+	ratio    int32
+	origin   int32
+	size     int32
+	capture  int32
+}
+
+// transitionProgram returns the compiled shader of a shader transition,
+// compiling it the first time. If it does not compile, the error is logged
+// once and nil is returned.
+func (r *GLXRenderer) transitionProgram(name types.Transition) *transitionProgram {
+	if p, ok := r.transitionPrograms[name]; ok {
+		return p
+	}
+
+	shader, _ := transition.Lookup(name)
+	prog, err := compileFragmentProgram(transition.FragmentSource(shader, false))
+	if err != nil {
+		log.Errorf("Transition %v failed to compile, fading instead: %v", name, err)
+		r.transitionPrograms[name] = nil
+		return nil
+	}
+
+	p := &transitionProgram{
+		program:  prog,
+		from:     gl.GetUniformLocation(prog, gl.Str("from\x00")),
+		to:       gl.GetUniformLocation(prog, gl.Str("to\x00")),
+		progress: gl.GetUniformLocation(prog, gl.Str("progress\x00")),
+		ratio:    gl.GetUniformLocation(prog, gl.Str("ratio\x00")),
+		origin:   gl.GetUniformLocation(prog, gl.Str("u_origin\x00")),
+		size:     gl.GetUniformLocation(prog, gl.Str("u_size\x00")),
+		capture:  gl.GetUniformLocation(prog, gl.Str("u_capture\x00")),
+	}
+	r.transitionPrograms[name] = p
+	return p
+}
+
+// compileFragmentProgram compiles and links a program with only a fragment
+// shader; vertices go through the fixed function pipeline.
+func compileFragmentProgram(src string) (uint32, error) {
+	shader := gl.CreateShader(gl.FRAGMENT_SHADER)
+	csrc, free := gl.Strs(src + "\x00")
+	gl.ShaderSource(shader, 1, csrc, nil)
+	free()
+	gl.CompileShader(shader)
+
+	var status int32
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status == gl.FALSE {
+		var logLen int32
+		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLen)
+		infoLog := make([]byte, max(logLen, 1))
+		gl.GetShaderInfoLog(shader, logLen, nil, &infoLog[0])
+		gl.DeleteShader(shader)
+		return 0, fmt.Errorf("shader compile error: %s", bytes.TrimRight(infoLog, "\x00\n"))
+	}
+
+	prog := gl.CreateProgram()
+	gl.AttachShader(prog, shader)
+	gl.LinkProgram(prog)
+	gl.DeleteShader(shader)
+
+	gl.GetProgramiv(prog, gl.LINK_STATUS, &status)
+	if status == gl.FALSE {
+		var logLen int32
+		gl.GetProgramiv(prog, gl.INFO_LOG_LENGTH, &logLen)
+		infoLog := make([]byte, max(logLen, 1))
+		gl.GetProgramInfoLog(prog, logLen, nil, &infoLog[0])
+		gl.DeleteProgram(prog)
+		return 0, fmt.Errorf("program link error: %s", bytes.TrimRight(infoLog, "\x00\n"))
+	}
+	return prog, nil
+}
+
+// renderShader draws a frame of a shader transition on every monitor. The
+// first frame captures the window showing each image, which the shader then
+// blends; while the images pan and zoom or play, every frame captures them
+// again.
+// It returns false if the shader did not compile.
+func (r *GLXRenderer) renderShader(progress float32, texA, texB texture) bool {
+	p := r.transitionProgram(r.active)
+	if p == nil {
+		return false
+	}
+
+	if r.fromCapture.id == 0 || r.kenBurns.Enabled || texA.atlas != nil || texB.atlas != nil {
+		deleteTexture(&r.fromCapture)
+		deleteTexture(&r.toCapture)
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		r.renderStatic(texA)
+		r.fromCapture = r.captureWindow()
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		r.renderStatic(texB)
+		r.toCapture = r.captureWindow()
+	}
+
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	gl.UseProgram(p.program)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, r.fromCapture.id)
+	gl.Uniform1i(p.from, 0)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, r.toCapture.id)
+	gl.Uniform1i(p.to, 1)
+	gl.Uniform1f(p.progress, progress)
+	gl.Uniform2f(p.capture, float32(r.width), float32(r.height))
+
+	for _, vp := range r.viewports() {
+		r.setViewport(vp)
+		gl.Uniform1f(p.ratio, float32(vp.width)/float32(vp.height))
+		gl.Uniform2f(p.origin, float32(vp.x), float32(r.height-vp.y-vp.height))
+		gl.Uniform2f(p.size, float32(vp.width), float32(vp.height))
+		gl.Rectf(-1, -1, 1, 1)
+	}
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.UseProgram(0)
+	return true
+}
+
+// captureWindow copies the backbuffer into a new texture.
+func (r *GLXRenderer) captureWindow() texture {
+	tex := texture{width: r.width, height: r.height}
+	gl.GenTextures(1, &tex.id)
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.CopyTexImage2D(gl.TEXTURE_2D, 0, gl.RGB, 0, 0, int32(r.width), int32(r.height), 0)
+	return tex
+}
+
+// drawShifted draws tex in the viewport moved by offset, in fractions of the
+// viewport. An empty texture fills the viewport with the current color.
+func (r *GLXRenderer) drawShifted(tex texture, vp monitor, offset [2]float32) {
+	gl.PushMatrix()
+	// the viewport is two units across
+	gl.Translatef(offset[0]*2, offset[1]*2, 0)
+	if tex.id == 0 {
+		gl.Rectf(-1, -1, 1, 1)
+	} else {
+		r.drawCenteredQuad(tex, vp)
+	}
+	gl.PopMatrix()
+}
 func (r *GLXRenderer) renderStatic(tex texture) {
 	if tex.id == 0 {
 		return
@@ -289,74 +752,71 @@ func (r *GLXRenderer) renderStatic(tex texture) {
 	gl.Enable(gl.TEXTURE_2D)
 	gl.BindTexture(gl.TEXTURE_2D, tex.id)
 	gl.Color4f(1, 1, 1, 1)
-	r.drawCenteredQuad(tex)
+	for _, vp := range r.viewports() {
+		r.setViewport(vp)
+		r.drawCenteredQuad(tex, vp)
+	}
 }
 
-func (r *GLXRenderer) drawCenteredQuad(tex texture) {
-	tw := float32(tex.width)
-	th := float32(tex.height)
-	sw := float32(r.width)
-	sh := float32(r.height)
-
-	tAspect := tw / th
-	sAspect := sw / sh
-
-	var hx, hy float32
-
-	switch r.scaleMode {
-	case types.ScalingModeStretch:
-		hx, hy = 1.0, 1.0
-
-	case types.ScalingModeFitHorizontal: // "horizontal"
-		hx = 1.0
-		// height scaled proportionally to width
-		hy = (th / tw) * (sw / sh)
-
-	case types.ScalingModeFitVertical: // "vertical"
-		hy = 1.0
-		// width scaled proportionally to height
-		hx = (tw / th) * (sh / sw)
+// setViewport points OpenGL at the part of the window a monitor shows. OpenGL
+// counts y from the bottom of the window, where X counts from the top.
+func (r *GLXRenderer) setViewport(vp monitor) {
+	gl.Viewport(int32(vp.x), int32(r.height-vp.y-vp.height), int32(vp.width), int32(vp.height))
+}
 
-	case types.ScalingModeCenter:
-		fallthrough
-	default:
-		// Fill as much as possible without cropping or stretching
-		if tAspect > sAspect {
-			hx = 1.0
-			hy = (sh / sw) * (tw / th)
-		} else {
-			hy = 1.0
-			hx = (sw / sh) * (th / tw)
-		}
+// drawCenteredQuad draws tex in the viewport using the scale mode, showing the
+// part of it that its pan and zoom has reached. The fit-blur scale mode draws
+// the blurred copy of the image over the whole viewport first. tex must be
+// bound.
+func (r *GLXRenderer) drawCenteredQuad(tex texture, vp monitor) {
+	view := tex.motion.View()
+	if r.scaleMode == types.ScalingModeFitBlur && tex.backdrop != 0 {
+		gl.BindTexture(gl.TEXTURE_2D, tex.backdrop)
+		drawQuads(quad.Layout(types.ScalingModeFill, vp.width, vp.height, tex.width, tex.height), view, nil)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	}
+	if vp.span.w > 0 {
+		// the monitor shows its part of the layout spanned with gaps
+		drawQuads([]quad.Quad{spanQuad(vp.span, tex.width, tex.height, view)}, kenburns.Full, tex.atlas)
+		return
+	}
+	// otherwise the viewport covers the whole window and so every monitor
+	// when spanning, which is laid out like fill
+	drawQuads(quad.Layout(r.scaleMode, vp.width, vp.height, tex.width, tex.height), view, tex.atlas)
+}
 
-		// Clamp to avoid overflow (optional, depending on design)
-		if hx > 1.0 {
-			hx = 1.0
-		}
-		if hy > 1.0 {
-			hy = 1.0
-		}
+// drawQuads draws the bound texture on quads. A single quad shows the part of
+// the texture that view has reached. For an animated image, sheet is the
+// atlas of its frames the texture holds, and the current frame is drawn.
+func drawQuads(quads []quad.Quad, view kenburns.View, sheet *atlas.Atlas) {
+	if len(quads) == 1 {
+		q := &quads[0]
+		q.U1, q.V1, q.U2, q.V2 = view.Crop(q.U1, q.V1, q.U2, q.V2)
 	}
 
 	gl.Begin(gl.QUADS)
-	gl.TexCoord2f(0.0, 1.0)
-	gl.Vertex2f(-hx, -hy)
-	gl.TexCoord2f(1.0, 1.0)
-	gl.Vertex2f(hx, -hy)
-	gl.TexCoord2f(1.0, 0.0)
-	gl.Vertex2f(hx, hy)
-	gl.TexCoord2f(0.0, 0.0)
-	gl.Vertex2f(-hx, hy)
+	for _, q := range quads {
+		q = sheet.Map(q)
+		gl.TexCoord2f(q.U1, q.V1)
+		gl.Vertex2f(q.X1, q.Y1)
+		gl.TexCoord2f(q.U2, q.V1)
+		gl.Vertex2f(q.X2, q.Y1)
+		gl.TexCoord2f(q.U2, q.V2)
+		gl.Vertex2f(q.X2, q.Y2)
+		gl.TexCoord2f(q.U1, q.V2)
+		gl.Vertex2f(q.X1, q.Y2)
+	}
 	gl.End()
 }
 
 func deleteTexture(tex *texture) {
 	if tex.id != 0 {
 		gl.DeleteTextures(1, &tex.id)
-		tex.id = 0
-		tex.width = 0
-		tex.height = 0
 	}
+	if tex.backdrop != 0 {
+		gl.DeleteTextures(1, &tex.backdrop)
+	}
+	*tex = texture{}
 }
 
 func (r *GLXRenderer) createColorTexture(rVal, gVal, bVal uint8) (*texture, error) {
@@ -394,7 +854,19 @@ func (r *GLXRenderer) IsDisplayRunning() bool {
 	return C.is_display_dead() == 0
 }
 
+// TryReconnect tears down what is left of the old connection and connects to
+// the display again, uploading the image that was being shown so the desktop
+// is not left black.
 func (r *GLXRenderer) TryReconnect() error {
-	log.Fatal("Unimplemented")
+	r.teardown()
+	if err := r.connect(); err != nil {
+		return err
+	}
+	if r.current != nil {
+		if err := r.SetImage(r.current); err != nil {
+			return fmt.Errorf("failed to restore image: %w", err)
+		}
+		r.pixmapStale = true
+	}
 	return nil
 }
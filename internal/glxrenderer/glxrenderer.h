@@ -3,6 +3,7 @@
 #include <X11/Xatom.h>
 #include <X11/Xlib.h>
 #include <X11/Xutil.h>
+#include <X11/extensions/Xrandr.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
@@ -20,9 +21,19 @@ int handle_io_error(Display *dpy) {
 // Sets the above handler as the default for X11 IO errors
 void set_io_error_handler() { XSetIOErrorHandler(handle_io_error); }
 
+// Called by Xlib after the IO error handler in place of exit(), so that the process
+// survives the X server going away and can reconnect once it is back.
+void handle_io_error_exit(Display *dpy, void *user_data) { display_gone = 1; }
+
+// Stops Xlib from exiting the process when the connection to dpy is lost
+void set_io_error_exit_handler(Display *dpy) { XSetIOErrorExitHandler(dpy, handle_io_error_exit, NULL); }
+
 // Utility to query if the display is marked dead
 int is_display_dead() { return display_gone; }
 
+// Clears the dead display flag once a new connection has been made
+void reset_display_gone() { display_gone = 0; }
+
 // Simple wrapper for XInternAtom to get a named atom (interned string handle)
 Atom get_atom(Display *dpy, const char *name) { return XInternAtom(dpy, name, False); }
 
@@ -97,6 +108,74 @@ int get_display_width(Display *dpy, int screen) { return DisplayWidth(dpy, scree
 // Get display height in pixels for a given screen
 int get_display_height(Display *dpy, int screen) { return DisplayHeight(dpy, screen); }
 
+// The area of the screen shown by one monitor, along with the name of its output
+typedef struct {
+    int  x, y, width, height;
+    char name[64];
+} monitor_info;
+
+// Asks for RRScreenChangeNotify events on the root window, so we hear about monitors
+// being plugged in, unplugged or rotated. Returns the RandR event base, or -1 if the
+// server does not support RandR.
+int select_screen_change(Display *dpy, int screen) {
+    int event_base, error_base;
+    if (!XRRQueryExtension(dpy, &event_base, &error_base)) {
+        return -1;
+    }
+    XRRSelectInput(dpy, RootWindow(dpy, screen), RRScreenChangeNotifyMask);
+    return event_base;
+}
+
+// Fills monitors with up to max of the CRTCs that are switched on and returns how many
+// were found. Each one is named after the first output it drives.
+int get_monitors(Display *dpy, int screen, monitor_info *monitors, int max) {
+    XRRScreenResources *res = XRRGetScreenResourcesCurrent(dpy, RootWindow(dpy, screen));
+    if (!res) {
+        return 0;
+    }
+
+    int n = 0;
+    for (int i = 0; i < res->ncrtc && n < max; i++) {
+        XRRCrtcInfo *crtc = XRRGetCrtcInfo(dpy, res, res->crtcs[i]);
+        if (!crtc) {
+            continue;
+        }
+        if (crtc->mode != None && crtc->noutput > 0 && crtc->width > 0 && crtc->height > 0) {
+            monitor_info *m = &monitors[n++];
+            m->x            = crtc->x;
+            m->y            = crtc->y;
+            m->width        = crtc->width;
+            m->height       = crtc->height;
+            m->name[0]      = '\0';
+
+            XRROutputInfo *out = XRRGetOutputInfo(dpy, res, crtc->outputs[0]);
+            if (out) {
+                snprintf(m->name, sizeof(m->name), "%.*s", out->nameLen, out->name);
+                XRRFreeOutputInfo(out);
+            }
+        }
+        XRRFreeCrtcInfo(crtc);
+    }
+
+    XRRFreeScreenResources(res);
+    return n;
+}
+
+// Handles the pending X events and returns 1 if the screen configuration changed. The
+// screen size Xlib reports is only updated once XRRUpdateConfiguration has seen the event.
+int process_events(Display *dpy, int randr_event_base) {
+    int changed = 0;
+    while (XPending(dpy)) {
+        XEvent ev;
+        XNextEvent(dpy, &ev);
+        if (randr_event_base >= 0 && ev.type == randr_event_base + RRScreenChangeNotify) {
+            XRRUpdateConfiguration(&ev);
+            changed = 1;
+        }
+    }
+    return changed;
+}
+
 // Creates a window that is override-redirect (ignored by window manager),
 // fully opaque black background, and placed at the lowest Z-order layer.
 // Also marks it as _NET_WM_WINDOW_TYPE_DESKTOP to hint it's the background.
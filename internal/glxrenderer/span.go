@@ -0,0 +1,89 @@
+package glxrenderer
+
+import (
+	"slices"
+
+	"github.com/matjam/smoothpaper/internal/kenburns"
+	"github.com/matjam/smoothpaper/internal/quad"
+)
+
+// spanView is the part of the combined monitor layout that one monitor
+// shows, in fractions of the layout, along with the aspect ratio of the
+// layout.
+type spanView struct {
+	x, y, w, h float32
+	aspect     float32
+}
+
+// spanLayout places the monitors in one layout using their positions on the
+// screen, and returns them with the part of the layout each one shows along
+// with the size of the layout in pixels. The gap is added between
+// neighbouring columns and rows of monitors, so that the part of the image
+// hidden behind the monitor bezels is skipped and lines crossing from one
+// monitor to the next stay straight. It is laid out as the Wayland renderer
+// lays out its outputs.
+func spanLayout(monitors []monitor, gap int) ([]monitor, int, int) {
+	var xs, ys []int
+	for _, m := range monitors {
+		xs = append(xs, m.x)
+		ys = append(ys, m.y)
+	}
+	if len(xs) == 0 {
+		return nil, 0, 0
+	}
+	slices.Sort(xs)
+	slices.Sort(ys)
+	xs = slices.Compact(xs)
+	ys = slices.Compact(ys)
+
+	type rect struct{ x, y, w, h int }
+	rects := make([]rect, len(monitors))
+	width, height := 0, 0
+	for i, m := range monitors {
+		col, _ := slices.BinarySearch(xs, m.x)
+		row, _ := slices.BinarySearch(ys, m.y)
+		rects[i] = rect{
+			x: m.x - xs[0] + col*gap,
+			y: m.y - ys[0] + row*gap,
+			w: m.width,
+			h: m.height,
+		}
+		width = max(width, rects[i].x+rects[i].w)
+		height = max(height, rects[i].y+rects[i].h)
+	}
+
+	spanned := slices.Clone(monitors)
+	for i, rc := range rects {
+		spanned[i].span = spanView{
+			x:      float32(rc.x) / float32(width),
+			y:      float32(rc.y) / float32(height),
+			w:      float32(rc.w) / float32(width),
+			h:      float32(rc.h) / float32(height),
+			aspect: float32(width) / float32(height),
+		}
+	}
+	return spanned, width, height
+}
+
+// spanQuad returns the quad that draws a monitor's part of a texture of
+// texWidth x texHeight pixels covering the whole layout, cropped to the
+// layout's aspect ratio. The pan and zoom moves across the whole layout, not
+// each monitor.
+func spanQuad(span spanView, texWidth, texHeight int, view kenburns.View) quad.Quad {
+	textureAspect := float32(texWidth) / float32(texHeight)
+	fw, fh := float32(1.0), float32(1.0)
+	if textureAspect > span.aspect {
+		fw = span.aspect / textureAspect
+	} else {
+		fh = textureAspect / span.aspect
+	}
+	ox, oy := (1-fw)/2, (1-fh)/2
+	a1, b1, a2, b2 := view.Crop(ox, oy, ox+fw, oy+fh)
+	return quad.Quad{
+		X1: -1, Y1: -1, X2: 1, Y2: 1,
+		U1: a1 + span.x*(a2-a1),
+		U2: a1 + (span.x+span.w)*(a2-a1),
+		V1: b1 + (span.y+span.h)*(b2-b1),
+		V2: b1 + span.y*(b2-b1),
+	}
+}
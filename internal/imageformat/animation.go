@@ -0,0 +1,159 @@
+package imageformat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"slices"
+	"time"
+)
+
+// Animation is an animated image. Every frame is fully composed and the size
+// of the whole image, and is shown for its delay before the next; after the
+// last frame the animation loops. As an image.Image it is its first frame, so
+// anything that cannot play it shows that.
+type Animation struct {
+	Frames []*image.RGBA
+	Delays []time.Duration
+}
+
+func (a *Animation) ColorModel() color.Model { return color.RGBAModel }
+func (a *Animation) Bounds() image.Rectangle { return a.Frames[0].Bounds() }
+func (a *Animation) At(x, y int) color.Color { return a.Frames[0].At(x, y) }
+
+// minFrameDelay is the shortest delay a frame is shown for. Browsers show
+// frames with a shorter delay, which is usually 0, for 100ms, and many
+// animations rely on it.
+const minFrameDelay = 20 * time.Millisecond
+
+// defaultFrameDelay is the delay of frames that give a delay shorter than
+// minFrameDelay.
+const defaultFrameDelay = 100 * time.Millisecond
+
+// decodeAnimation decodes an animated GIF, PNG or WebP image. It returns nil
+// for images with a single frame, which are decoded as still images.
+func decodeAnimation(format string, data []byte) (*Animation, error) {
+	switch format {
+	case "gif":
+		return decodeGIF(data)
+	case "png":
+		return decodeAPNG(data)
+	case "webp":
+		return decodeAnimatedWebP(data)
+	}
+	return nil, nil
+}
+
+// maxAnimationMemory is how many bytes the composed frames of an animation
+// may take. Animations that need more are shown as their still first frame,
+// rather than holding gigabytes of frames until they are scaled down to the
+// screen.
+var maxAnimationMemory = 1 << 30
+
+// disposal is what happens to the part of the canvas a frame was drawn on
+// before the next frame is drawn.
+type disposal int
+
+const (
+	disposeNone       disposal = iota // the frame stays on the canvas
+	disposeBackground                 // the frame's area is cleared to transparent
+	disposePrevious                   // the canvas goes back to how it was before the frame
+)
+
+// composer builds the frames of an animation by drawing each one on a canvas
+// the size of the whole image, as they only cover the part that changes.
+type composer struct {
+	anim     Animation
+	canvas   *image.RGBA
+	previous []byte // the canvas before the frame, for frames disposed to the previous one
+	size     int    // bytes taken by the frames
+	tooLarge bool   // whether the frames went over maxAnimationMemory
+}
+
+func newComposer(width, height int) *composer {
+	return &composer{canvas: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+// add draws img at the given area of the canvas, blending it over what is
+// there or replacing it, adds the result as the next frame and then disposes
+// of the frame. It returns false, dropping the frames, once they would take
+// more than maxAnimationMemory, and the rest need not be decoded.
+func (c *composer) add(img image.Image, at image.Rectangle, over bool, dispose disposal, delay time.Duration) bool {
+	if c.tooLarge || c.size+len(c.canvas.Pix) > maxAnimationMemory {
+		c.tooLarge = true
+		c.anim = Animation{}
+		return false
+	}
+	c.size += len(c.canvas.Pix)
+
+	if dispose == disposePrevious {
+		c.previous = append(c.previous[:0], c.canvas.Pix...)
+	}
+
+	op := draw.Src
+	if over {
+		op = draw.Over
+	}
+	draw.Draw(c.canvas, at, img, img.Bounds().Min, op)
+
+	if delay < minFrameDelay {
+		delay = defaultFrameDelay
+	}
+	c.anim.Frames = append(c.anim.Frames, &image.RGBA{
+		Pix:    slices.Clone(c.canvas.Pix),
+		Stride: c.canvas.Stride,
+		Rect:   c.canvas.Rect,
+	})
+	c.anim.Delays = append(c.anim.Delays, delay)
+
+	switch dispose {
+	case disposeBackground:
+		draw.Draw(c.canvas, at, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		copy(c.canvas.Pix, c.previous)
+	}
+	return true
+}
+
+// animation returns the composed animation, or nil if it only had one frame
+// or was too large, so that it is decoded as a still image.
+func (c *composer) animation() *Animation {
+	if c.tooLarge || len(c.anim.Frames) < 2 {
+		return nil
+	}
+	return &c.anim
+}
+
+func decodeGIF(data []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) < 2 {
+		return nil, nil
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 || height == 0 {
+		width, height = g.Image[0].Bounds().Dx(), g.Image[0].Bounds().Dy()
+	}
+	c := newComposer(width, height)
+	for i, frame := range g.Image {
+		dispose := disposeNone
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				dispose = disposeBackground
+			case gif.DisposalPrevious:
+				dispose = disposePrevious
+			}
+		}
+		// GIF delays are in hundredths of a second
+		if !c.add(frame, frame.Bounds(), true, dispose, time.Duration(g.Delay[i])*10*time.Millisecond) {
+			break
+		}
+	}
+	return c.animation(), nil
+}
@@ -0,0 +1,79 @@
+package imageformat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// testGIF returns an animated GIF of frames frames of 4x4 pixels, each a
+// different shade of gray.
+func testGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	palette := color.Palette{color.Black, color.White, color.Gray{Y: 128}}
+	for i := range frames {
+		img := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+		for p := range img.Pix {
+			img.Pix[p] = uint8(i % len(palette))
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	img, err := Decode(testGIF(t, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, ok := img.(*Animation)
+	if !ok {
+		t.Fatalf("Decode returned %T, want *Animation", img)
+	}
+	if len(anim.Frames) != 4 {
+		t.Errorf("got %d frames, want 4", len(anim.Frames))
+	}
+}
+
+func TestDecodeAnimationOverMemoryLimit(t *testing.T) {
+	defer func(limit int) { maxAnimationMemory = limit }(maxAnimationMemory)
+	// room for three of the four 4x4 RGBA frames
+	maxAnimationMemory = 3 * 4 * 4 * 4
+
+	img, err := Decode(testGIF(t, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*Animation); ok {
+		t.Fatal("Decode returned an animation over the memory limit, want the still first frame")
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 4 {
+		t.Errorf("still frame is %v, want 4x4", b)
+	}
+}
+
+func TestDecodePNGWithTrailingData(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	// some writers leave padding or other data after IEND
+	buf.Write(bytes.Repeat([]byte{0xff}, 16))
+
+	img, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode failed on a PNG with trailing data: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 4 {
+		t.Errorf("image is %v, want 4x4", b)
+	}
+}
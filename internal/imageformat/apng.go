@@ -0,0 +1,147 @@
+package imageformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"time"
+)
+
+// pngChunk is a chunk of a PNG file.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// apngFrame is a frame of an APNG image: its fcTL chunk and the compressed
+// image data that follows it.
+type apngFrame struct {
+	control []byte
+	data    [][]byte
+}
+
+// decodeAPNG decodes an animated PNG. The image package only reads the
+// default image, so each frame is turned into a PNG of its own, with the
+// chunks it shares with the others, and decoded on its own.
+func decodeAPNG(data []byte) (*Animation, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		// the png package decides whether a damaged file can still be shown
+		return nil, nil
+	}
+
+	var header []byte
+	var shared []pngChunk
+	var frames []*apngFrame
+	animated := false
+	seenData := false
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "IHDR":
+			header = chunk.data
+		case "acTL":
+			animated = true
+		case "fcTL":
+			frames = append(frames, &apngFrame{control: chunk.data})
+		case "IDAT":
+			seenData = true
+			// the default image is only the first frame if a fcTL comes first
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, chunk.data)
+			}
+		case "fdAT":
+			if len(frames) > 0 && len(chunk.data) > 4 {
+				// skip the sequence number
+				frames[len(frames)-1].data = append(frames[len(frames)-1].data, chunk.data[4:])
+			}
+		case "IEND":
+		default:
+			if !seenData {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+	if !animated || len(frames) < 2 || len(header) < 13 {
+		return nil, nil
+	}
+
+	c := newComposer(int(binary.BigEndian.Uint32(header)), int(binary.BigEndian.Uint32(header[4:])))
+	for i, frame := range frames {
+		if len(frame.control) < 26 || len(frame.data) == 0 {
+			return nil, errors.New("apng: invalid frame")
+		}
+		fc := frame.control
+		width, height := binary.BigEndian.Uint32(fc[4:]), binary.BigEndian.Uint32(fc[8:])
+		x, y := int(binary.BigEndian.Uint32(fc[12:])), int(binary.BigEndian.Uint32(fc[16:]))
+		num, den := binary.BigEndian.Uint16(fc[20:]), binary.BigEndian.Uint16(fc[22:])
+		if den == 0 {
+			den = 100
+		}
+
+		img, err := png.Decode(bytes.NewReader(framePNG(header, width, height, shared, frame.data)))
+		if err != nil {
+			return nil, err
+		}
+
+		dispose := disposal(fc[24])
+		if dispose == disposePrevious && i == 0 {
+			dispose = disposeBackground
+		}
+		at := image.Rect(x, y, x+int(width), y+int(height))
+		delay := time.Duration(num) * time.Second / time.Duration(den)
+		if !c.add(img, at, fc[25] == 1, dispose, delay) {
+			break
+		}
+	}
+	return c.animation(), nil
+}
+
+// pngChunks splits a PNG file into its chunks, up to and including IEND.
+// Anything after IEND is ignored, as the png package ignores it.
+func pngChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	i := 8 // skip the signature
+	for i+12 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		if size < 0 || i+12+size > len(data) {
+			return nil, errors.New("png: truncated chunk")
+		}
+		chunk := pngChunk{kind: string(data[i+4 : i+8]), data: data[i+8 : i+8+size]}
+		chunks = append(chunks, chunk)
+		if chunk.kind == "IEND" {
+			break
+		}
+		i += 12 + size
+	}
+	return chunks, nil
+}
+
+// framePNG returns a PNG of one frame of an APNG image.
+func framePNG(header []byte, width, height uint32, shared []pngChunk, data [][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+
+	ihdr := bytes.Clone(header)
+	binary.BigEndian.PutUint32(ihdr, width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	writePNGChunk(&b, "IHDR", ihdr)
+	for _, chunk := range shared {
+		writePNGChunk(&b, chunk.kind, chunk.data)
+	}
+	writePNGChunk(&b, "IDAT", bytes.Join(data, nil))
+	writePNGChunk(&b, "IEND", nil)
+	return b.Bytes()
+}
+
+func writePNGChunk(b *bytes.Buffer, kind string, data []byte) {
+	b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	b.WriteString(kind)
+	b.Write(data)
+	b.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
@@ -0,0 +1,138 @@
+// Package imageformat is the registry of image formats smoothpaper can show.
+// Importing it registers the decoders for every format with the image
+// package, and formats are recognised by their file signature rather than
+// the file extension.
+package imageformat
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	// register image decoders with the image package
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Format describes a supported image format.
+type Format struct {
+	Name  string   // the name image.Decode reports for the format
+	Magic []string // file signatures; a '?' matches any byte
+}
+
+// Formats is every format smoothpaper can decode.
+var Formats = []Format{
+	{Name: "png", Magic: []string{"\x89PNG\r\n\x1a\n"}},
+	{Name: "jpeg", Magic: []string{"\xff\xd8"}},
+	{Name: "gif", Magic: []string{"GIF87a", "GIF89a"}},
+	{Name: "webp", Magic: []string{"RIFF????WEBPVP8"}},
+	// the reserved bytes after the file size are not always zero, so the
+	// size of the info header, which the bmp package reads, is matched instead
+	{Name: "bmp", Magic: []string{"BM????????????\x28\x00\x00\x00", "BM????????????\x6c\x00\x00\x00", "BM????????????\x7c\x00\x00\x00"}},
+	{Name: "tiff", Magic: []string{"II*\x00", "MM\x00*"}},
+}
+
+func init() {
+	// the bmp package only registers files whose reserved bytes are zero, so
+	// the others are decoded by registering it for these signatures as well
+	for _, f := range Formats {
+		if f.Name == "bmp" {
+			for _, magic := range f.Magic {
+				image.RegisterFormat("bmp", magic, bmp.Decode, bmp.DecodeConfig)
+			}
+		}
+	}
+}
+
+// headerSize is enough of the file to match every signature.
+const headerSize = 18
+
+// Detect returns the format whose signature matches the start of header.
+func Detect(header []byte) (Format, bool) {
+	for _, f := range Formats {
+		for _, magic := range f.Magic {
+			if match(magic, header) {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// DetectFile reads the start of the file at path and returns its format.
+func DetectFile(path string) (Format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Format{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Format{}, fmt.Errorf("failed to read %v: %w", path, err)
+	}
+
+	f, ok := Detect(header[:n])
+	if !ok {
+		return Format{}, fmt.Errorf("%v is not a supported image format (supported: %v)", path, strings.Join(Names(), ", "))
+	}
+	return f, nil
+}
+
+// IsImage reports whether the file at path is in a supported format.
+func IsImage(path string) bool {
+	_, err := DetectFile(path)
+	return err == nil
+}
+
+func match(magic string, header []byte) bool {
+	if len(header) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Names returns the names of the supported formats.
+func Names() []string {
+	names := make([]string, 0, len(Formats))
+	for _, f := range Formats {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// Decode decodes an encoded image in any supported format and applies its
+// EXIF orientation, so that photos appear upright. Animated GIF, PNG and WebP
+// images are returned as an *Animation.
+func Decode(data []byte) (image.Image, error) {
+	f, ok := Detect(data)
+	if !ok {
+		return nil, fmt.Errorf("not a supported image format (supported: %v)", strings.Join(Names(), ", "))
+	}
+	anim, err := decodeAnimation(f.Name, data)
+	if err != nil {
+		return nil, err
+	}
+	if anim != nil {
+		return anim, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ApplyOrientation(img, Orientation(data)), nil
+}
@@ -0,0 +1,47 @@
+package imageformat
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestDetect(t *testing.T) {
+	var pngData, bmpData bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := bmp.Encode(&bmpData, img); err != nil {
+		t.Fatal(err)
+	}
+	// some writers use the reserved bytes of the BMP file header
+	reserved := bytes.Clone(bmpData.Bytes())
+	copy(reserved[6:10], "GIMP")
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"png", pngData.Bytes(), "png"},
+		{"bmp", bmpData.Bytes(), "bmp"},
+		{"bmp with reserved bytes", reserved, "bmp"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "gif"},
+		{"bmp with an unknown header", []byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00\x00\x00"), ""},
+		{"text", []byte("BM is not an image"), ""},
+	}
+	for _, tt := range tests {
+		f, ok := Detect(tt.header)
+		if f.Name != tt.want || ok != (tt.want != "") {
+			t.Errorf("%v: Detect = %q, %v, want %q", tt.name, f.Name, ok, tt.want)
+		}
+	}
+
+	if _, err := Decode(reserved); err != nil {
+		t.Errorf("Decode failed on a BMP with reserved bytes: %v", err)
+	}
+}
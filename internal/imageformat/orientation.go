@@ -0,0 +1,181 @@
+package imageformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// EXIF orientation values. Each one describes how the stored pixels must be
+// transformed for the image to appear upright.
+const (
+	OrientationNormal     = 1 // no transformation
+	OrientationFlipH      = 2 // mirror horizontally
+	OrientationRotate180  = 3 // rotate 180 degrees
+	OrientationFlipV      = 4 // mirror vertically
+	OrientationTranspose  = 5 // mirror across the top-left to bottom-right diagonal
+	OrientationRotate90   = 6 // rotate 90 degrees clockwise
+	OrientationTransverse = 7 // mirror across the top-right to bottom-left diagonal
+	OrientationRotate270  = 8 // rotate 90 degrees counter-clockwise
+)
+
+const (
+	exifHeader     = "Exif\x00\x00"
+	tagOrientation = 0x0112
+	typeShort      = 3
+)
+
+// Orientation returns the EXIF orientation stored in an encoded JPEG, TIFF
+// or WebP image, or OrientationNormal if there is none.
+func Orientation(data []byte) int {
+	f, _ := Detect(data)
+	switch f.Name {
+	case "jpeg":
+		return jpegOrientation(data)
+	case "tiff":
+		return tiffOrientation(data)
+	case "webp":
+		return webpOrientation(data)
+	}
+	return OrientationNormal
+}
+
+// jpegOrientation finds the EXIF APP1 segment among the segments before the
+// image data.
+func jpegOrientation(data []byte) int {
+	i := 2 // skip SOI
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xd9 || marker == 0xda {
+			// end of image or start of scan; EXIF always comes before these
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte(exifHeader)) {
+			return tiffOrientation(segment[len(exifHeader):])
+		}
+		i += 2 + length
+	}
+	return OrientationNormal
+}
+
+// webpOrientation finds the EXIF chunk of an extended WebP file.
+func webpOrientation(data []byte) int {
+	i := 12 // skip the RIFF header
+	for i+8 <= len(data) {
+		fourcc := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			break
+		}
+		if fourcc == "EXIF" {
+			// some encoders keep the JPEG style header in front of the TIFF data
+			return tiffOrientation(bytes.TrimPrefix(data[i+8:i+8+size], []byte(exifHeader)))
+		}
+		i += 8 + size + size%2
+	}
+	return OrientationNormal
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of TIFF
+// structured data, which is also how EXIF data is stored.
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return OrientationNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return OrientationNormal
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return OrientationNormal
+	}
+
+	ifd := int(order.Uint32(data[4:]))
+	if ifd < 8 || ifd+2 > len(data) {
+		return OrientationNormal
+	}
+	entries := int(order.Uint16(data[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(data) {
+			break
+		}
+		if order.Uint16(data[entry:]) != tagOrientation {
+			continue
+		}
+		if order.Uint16(data[entry+2:]) != typeShort {
+			break
+		}
+		if v := int(order.Uint16(data[entry+8:])); v >= OrientationNormal && v <= OrientationRotate270 {
+			return v
+		}
+		break
+	}
+	return OrientationNormal
+}
+
+// ApplyOrientation returns img transformed so that it appears upright for
+// the given EXIF orientation.
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= OrientationNormal || orientation > OrientationRotate270 {
+		return img
+	}
+
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= OrientationTranspose {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case OrientationFlipH:
+				sx, sy = w-1-x, y
+			case OrientationRotate180:
+				sx, sy = w-1-x, h-1-y
+			case OrientationFlipV:
+				sx, sy = x, h-1-y
+			case OrientationTranspose:
+				sx, sy = y, x
+			case OrientationRotate90:
+				sx, sy = y, h-1-x
+			case OrientationTransverse:
+				sx, sy = w-1-y, h-1-x
+			case OrientationRotate270:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,184 @@
+package imageformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// labels name the pixels of the 3x2 test image, row by row.
+const labels = "ABCDEF"
+
+// testImage returns a 3x2 image whose pixels are all different, encoded as a
+// PNG and decoded again so that ApplyOrientation sees a decoder's image type.
+func testImage(t *testing.T) image.Image {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range labels {
+		img.Set(i%3, i/3, labelColor(i))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func labelColor(i int) color.NRGBA {
+	return color.NRGBA{R: uint8(40 * (i + 1)), G: uint8(200 - 30*i), B: uint8(i * 7), A: 255}
+}
+
+// grid returns the labels of the pixels of img, one string per row.
+func grid(t *testing.T, img image.Image) []string {
+	t.Helper()
+	b := img.Bounds()
+	rows := make([]string, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := make([]byte, 0, b.Dx())
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			label := byte('?')
+			for i := range labels {
+				if labelColor(i) == c {
+					label = labels[i]
+				}
+			}
+			row = append(row, label)
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+// exif returns TIFF structured data with a single IFD entry holding the
+// orientation.
+func exif(order binary.ByteOrder, orientation int) []byte {
+	b := make([]byte, 26)
+	if order == binary.BigEndian {
+		copy(b, "MM")
+	} else {
+		copy(b, "II")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+	order.PutUint16(b[8:], 1)
+	order.PutUint16(b[10:], tagOrientation)
+	order.PutUint16(b[12:], typeShort)
+	order.PutUint32(b[14:], 1)
+	order.PutUint16(b[18:], uint16(orientation))
+	return b
+}
+
+// encodeJPEG encodes img as a JPEG with an EXIF APP1 segment after the SOI
+// marker.
+func encodeJPEG(t *testing.T, img image.Image, orientation int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	payload := append([]byte(exifHeader), exif(binary.BigEndian, orientation)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	data := append([]byte{}, encoded[:2]...)
+	data = append(data, segment...)
+	return append(data, encoded[2:]...)
+}
+
+// encodeWebP builds an extended WebP container with a VP8X chunk and an
+// EXIF chunk. The image data itself is never read.
+func encodeWebP(orientation int) []byte {
+	chunk := func(fourcc string, payload []byte) []byte {
+		c := []byte(fourcc)
+		c = binary.LittleEndian.AppendUint32(c, uint32(len(payload)))
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", make([]byte, 10))...)
+	body = append(body, chunk("EXIF", exif(binary.LittleEndian, orientation))...)
+
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(body)))
+	return append(data, body...)
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{OrientationNormal, []string{"ABC", "DEF"}},
+		{OrientationFlipH, []string{"CBA", "FED"}},
+		{OrientationRotate180, []string{"FED", "CBA"}},
+		{OrientationFlipV, []string{"DEF", "ABC"}},
+		{OrientationTranspose, []string{"AD", "BE", "CF"}},
+		{OrientationRotate90, []string{"DA", "EB", "FC"}},
+		{OrientationTransverse, []string{"FC", "EB", "DA"}},
+		{OrientationRotate270, []string{"CF", "BE", "AD"}},
+	}
+
+	img := testImage(t)
+	for _, tt := range tests {
+		encoded := map[string][]byte{
+			"jpeg": encodeJPEG(t, img, tt.orientation),
+			"tiff": exif(binary.BigEndian, tt.orientation),
+			"webp": encodeWebP(tt.orientation),
+		}
+		for name, data := range encoded {
+			if got := Orientation(data); got != tt.orientation {
+				t.Errorf("%s: Orientation = %d, want %d", name, got, tt.orientation)
+			}
+		}
+
+		oriented := ApplyOrientation(img, tt.orientation)
+		b := oriented.Bounds()
+		wantW, wantH := 3, 2
+		if tt.orientation >= OrientationTranspose {
+			wantW, wantH = 2, 3
+		}
+		if b.Dx() != wantW || b.Dy() != wantH {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), wantW, wantH)
+			continue
+		}
+		got := grid(t, oriented)
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("orientation %d: pixels %v, want %v", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestOrientationMissing(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]byte{
+		"jpeg without exif": buf.Bytes(),
+		"png":               []byte("\x89PNG\r\n\x1a\n"),
+		"truncated tiff":    []byte("II*\x00\x08"),
+		"out of range":      exif(binary.LittleEndian, 9),
+	}
+	for name, data := range tests {
+		if got := Orientation(data); got != OrientationNormal {
+			t.Errorf("%s: Orientation = %d, want %d", name, got, OrientationNormal)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package imageformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// webpAnimationFlag is set in the VP8X chunk of an animated WebP image.
+const webpAnimationFlag = 0x02
+
+// decodeAnimatedWebP decodes an animated WebP image. The webp package only
+// reads still images, so each frame is turned into a WebP file of its own
+// and decoded on its own.
+func decodeAnimatedWebP(data []byte) (*Animation, error) {
+	chunks := webpChunks(data)
+	if len(chunks) == 0 || chunks[0].kind != "VP8X" || len(chunks[0].data) < 10 || chunks[0].data[0]&webpAnimationFlag == 0 {
+		return nil, nil
+	}
+	vp8x := chunks[0].data
+	c := newComposer(int(uint24(vp8x[4:]))+1, int(uint24(vp8x[7:]))+1)
+
+	for _, chunk := range chunks[1:] {
+		if chunk.kind != "ANMF" {
+			continue
+		}
+		f := chunk.data
+		if len(f) < 16 {
+			return nil, errors.New("webp: invalid frame")
+		}
+		x, y := 2*int(uint24(f)), 2*int(uint24(f[3:]))
+		width, height := int(uint24(f[6:]))+1, int(uint24(f[9:]))+1
+		delay := time.Duration(uint24(f[12:])) * time.Millisecond
+		flags := f[15]
+
+		img, err := webp.Decode(bytes.NewReader(frameWebP(webpChunks(f[16:]), width, height)))
+		if err != nil {
+			return nil, err
+		}
+
+		dispose := disposeNone
+		if flags&0x01 != 0 {
+			dispose = disposeBackground
+		}
+		at := image.Rect(x, y, x+width, y+height)
+		if !c.add(img, at, flags&0x02 == 0, dispose, delay) {
+			break
+		}
+	}
+	return c.animation(), nil
+}
+
+// webpChunks splits the chunks that follow the RIFF header of a WebP file,
+// or the header of an ANMF chunk, which holds chunks of its own.
+func webpChunks(data []byte) []pngChunk {
+	if bytes.HasPrefix(data, []byte("RIFF")) {
+		data = data[min(12, len(data)):]
+	}
+	var chunks []pngChunk
+	i := 0
+	for i+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			break
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[i : i+4]), data: data[i+8 : i+8+size]})
+		i += 8 + size + size%2
+	}
+	return chunks
+}
+
+// frameWebP returns a WebP file of one frame of an animated WebP image, from
+// the chunks of its ANMF chunk. A frame with an alpha channel needs a VP8X
+// chunk to say so.
+func frameWebP(chunks []pngChunk, width, height int) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		if chunk.kind == "ALPH" {
+			vp8x := make([]byte, 10)
+			vp8x[0] = 0x10 // alpha
+			putUint24(vp8x[4:], uint32(width-1))
+			putUint24(vp8x[7:], uint32(height-1))
+			writeWebPChunk(&body, "VP8X", vp8x)
+			break
+		}
+	}
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "ALPH", "VP8 ", "VP8L":
+			writeWebPChunk(&body, chunk.kind, chunk.data)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	b.Write(binary.LittleEndian.AppendUint32(nil, uint32(body.Len())))
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+func writeWebPChunk(b *bytes.Buffer, kind string, data []byte) {
+	b.WriteString(kind)
+	b.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	b.Write(data)
+	if len(data)%2 == 1 {
+		b.WriteByte(0)
+	}
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
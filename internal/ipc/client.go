@@ -6,6 +6,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 
 	"resty.dev/v3"
 )
@@ -15,16 +17,67 @@ func SendNext() error {
 	return err
 }
 
+func SendPrevious() error {
+	_, err := getRestyClient().R().Post("/previous")
+	return err
+}
+
 func SendStop() error {
 	_, err := getRestyClient().R().Post("/stop")
 	return err
 }
 
+func SendPause() error {
+	_, err := getRestyClient().R().Post("/pause")
+	return err
+}
+
+func SendResume() error {
+	_, err := getRestyClient().R().Post("/resume")
+	return err
+}
+
+func SendToggle() error {
+	_, err := getRestyClient().R().Post("/toggle")
+	return err
+}
+
+func SendSet(wallpaper string) error {
+	var errResp map[string]string
+	resp, err := getRestyClient().R().
+		SetBody(SetRequest{Wallpaper: wallpaper}).
+		SetError(&errResp).
+		Post("/set")
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("set failed: %s", errResp["error"])
+	}
+	return nil
+}
+
 func SendLoad(wallpapers []string) error {
-	_, err := getRestyClient().R().
+	var errResp struct {
+		Error   string            `json:"error"`
+		Invalid map[string]string `json:"invalid"`
+	}
+	resp, err := getRestyClient().R().
 		SetBody(wallpapers).
+		SetError(&errResp).
 		Post("/load")
-	return err
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		reasons := make([]string, 0, len(errResp.Invalid))
+		for _, reason := range errResp.Invalid {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		return fmt.Errorf("load failed: %s: %s", errResp.Error, strings.Join(reasons, "; "))
+	}
+	return nil
 }
 
 func SendStatus() (*StatusResponse, error) {
@@ -41,6 +94,34 @@ func SendStatus() (*StatusResponse, error) {
 	return &status, nil
 }
 
+func SendErrors() ([]FailedWallpaper, error) {
+	var failed []FailedWallpaper
+	resp, err := getRestyClient().R().
+		SetResult(&failed).
+		Get("/errors")
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("errors request failed: %s", resp.Status())
+	}
+	return failed, nil
+}
+
+func SendSchedule() (*ScheduleResponse, error) {
+	var schedule ScheduleResponse
+	resp, err := getRestyClient().R().
+		SetResult(&schedule).
+		Get("/schedule")
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("schedule request failed: %s", resp.Status())
+	}
+	return &schedule, nil
+}
+
 func getRestyClient() *resty.Client {
 	sockDir := os.Getenv("XDG_RUNTIME_DIR")
 	if sockDir == "" {
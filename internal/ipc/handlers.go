@@ -1,12 +1,15 @@
 package ipc
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/matjam/smoothpaper"
+	"github.com/matjam/smoothpaper/internal/imageformat"
 	"github.com/spf13/viper"
 )
 
@@ -21,10 +24,28 @@ func statusHandler(m ManagerInterface) echo.HandlerFunc {
 			Socket:           os.Getenv("XDG_RUNTIME_DIR") + "/smoothpaper.sock",
 			Config:           viper.ConfigFileUsed(),
 			CurrentWallpaper: m.CurrentWallpaper(),
+			Paused:           m.Paused(),
+			SecondsRemaining: int(m.TimeRemaining().Seconds()),
+			FailedWallpapers: m.FailedWallpapers(),
+			Outputs:          m.OutputWallpapers(),
 		}, "  ")
 	}
 }
 
+// GET /errors
+func errorsHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSONPretty(http.StatusOK, m.FailedWallpapers(), "  ")
+	}
+}
+
+// GET /schedule
+func scheduleHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSONPretty(http.StatusOK, m.Schedule(), "  ")
+	}
+}
+
 // POST /stop
 func stopHandler(m ManagerInterface) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -41,6 +62,74 @@ func nextHandler(m ManagerInterface) echo.HandlerFunc {
 	}
 }
 
+// POST /previous
+func previousHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		m.EnqueueCommand(Command{Type: CommandPrevious})
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// POST /pause
+func pauseHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		m.EnqueueCommand(Command{Type: CommandPause})
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// POST /resume
+func resumeHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		m.EnqueueCommand(Command{Type: CommandResume})
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// POST /toggle
+func toggleHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		m.EnqueueCommand(Command{Type: CommandTogglePause})
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// POST /set
+func setHandler(m ManagerInterface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req SetRequest
+		if err := c.Bind(&req); err != nil || req.Wallpaper == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON wallpaper request"})
+		}
+
+		if !filepath.IsAbs(req.Wallpaper) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "wallpaper path must be absolute"})
+		}
+
+		if _, err := imageformat.DetectFile(req.Wallpaper); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		// the Run loop decodes it, so wait for it to report whether it could
+		done := make(chan error, 1)
+		m.EnqueueCommand(Command{
+			Type: CommandSet,
+			Args: []string{req.Wallpaper},
+			Done: done,
+		})
+		select {
+		case err := <-done:
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
 // POST /load
 func loadHandler(m ManagerInterface) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -49,6 +138,23 @@ func loadHandler(m ManagerInterface) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON array of wallpapers"})
 		}
 
+		invalid := make(map[string]string)
+		for _, wallpaper := range wallpapers {
+			if !filepath.IsAbs(wallpaper) {
+				invalid[wallpaper] = fmt.Sprintf("%v: wallpaper path must be absolute", wallpaper)
+				continue
+			}
+			if _, err := imageformat.DetectFile(wallpaper); err != nil {
+				invalid[wallpaper] = err.Error()
+			}
+		}
+		if len(invalid) > 0 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error":   "some wallpapers cannot be loaded",
+				"invalid": invalid,
+			})
+		}
+
 		m.EnqueueCommand(Command{
 			Type: CommandLoad,
 			Args: wallpapers,
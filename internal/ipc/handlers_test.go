@@ -0,0 +1,80 @@
+package ipc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fakeManager records the commands it is sent and replies to each with err.
+type fakeManager struct {
+	cmds []Command
+	err  error
+}
+
+func (m *fakeManager) CurrentWallpaper() string            { return "" }
+func (m *fakeManager) Paused() bool                        { return false }
+func (m *fakeManager) TimeRemaining() time.Duration        { return 0 }
+func (m *fakeManager) FailedWallpapers() []FailedWallpaper { return nil }
+func (m *fakeManager) OutputWallpapers() map[string]string { return nil }
+func (m *fakeManager) Schedule() ScheduleResponse          { return ScheduleResponse{} }
+
+func (m *fakeManager) EnqueueCommand(cmd Command) {
+	m.cmds = append(m.cmds, cmd)
+	cmd.reply(m.err)
+}
+
+// post sends body to the handler as JSON and returns the response.
+func post(t *testing.T, handler echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestSetHandler(t *testing.T) {
+	wallpaper := writeWallpapers(t, 1)[0]
+	text := filepath.Join(t.TempDir(), "notes.png")
+	if err := os.WriteFile(text, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		wallpaper string
+		err       error // the manager's reply
+		status    int
+		sent      bool
+	}{
+		{"image", wallpaper, nil, http.StatusOK, true},
+		{"relative path", "wallpapers/a.png", nil, http.StatusBadRequest, false},
+		{"not an image", text, nil, http.StatusBadRequest, false},
+		{"fails to load", wallpaper, errors.New("corrupt image"), http.StatusBadRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &fakeManager{err: tt.err}
+			rec := post(t, setHandler(m), `{"wallpaper": "`+tt.wallpaper+`"}`)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if sent := len(m.cmds) > 0; sent != tt.sent {
+				t.Fatalf("command sent: %v, want %v", sent, tt.sent)
+			}
+			if tt.sent && (m.cmds[0].Type != CommandSet || len(m.cmds[0].Args) != 1 || m.cmds[0].Args[0] != tt.wallpaper) {
+				t.Errorf("sent %+v, want a set command for %v", m.cmds[0], tt.wallpaper)
+			}
+		})
+	}
+}
@@ -1,26 +1,96 @@
 package ipc
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"image"
-	"math/rand/v2"
+	"image/color"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/matjam/smoothpaper/internal/glxrenderer"
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/kenburns"
+	"github.com/matjam/smoothpaper/internal/resample"
+	"github.com/matjam/smoothpaper/internal/schedule"
+	"github.com/matjam/smoothpaper/internal/selection"
+	"github.com/matjam/smoothpaper/internal/session"
+	"github.com/matjam/smoothpaper/internal/transition"
 	"github.com/matjam/smoothpaper/internal/types"
 	"github.com/matjam/smoothpaper/internal/wlrenderer"
 	"github.com/spf13/viper"
 )
 
+// historySize is the maximum number of previously shown wallpapers that the
+// manager remembers for the previous command.
+const historySize = 100
+
+// reconnectBackoffMin and reconnectBackoffMax bound how long the manager waits
+// between attempts to reconnect to a display that has gone away.
+const (
+	reconnectBackoffMin = 1 * time.Second
+	reconnectBackoffMax = 30 * time.Second
+)
+
+// stateSaveInterval is the least time between saves of the state while the
+// manager runs, so that a burst of changes is written once.
+const stateSaveInterval = 5 * time.Second
+
+// socketGoneTimeout is how long the Wayland socket may stay missing while
+// reconnecting before the session is taken to have ended, when
+// reconnect_timeout sets no limit of its own.
+const socketGoneTimeout = 2 * time.Minute
+
 type Manager struct {
 	sync.Mutex
 	wallpapers       []string // list of wallpaper paths\
 	renderer         Renderer
 	cmds             chan Command
 	currentWallpaper string
+	history          []string // previously shown wallpapers, most recent last
+	forward          []string // wallpapers stepped back over, replayed before the rotation continues
+
+	delay       time.Duration // time between wallpaper changes
+	timeChanged time.Time     // when the current wallpaper was shown
+	paused      bool          // whether the slideshow timer is paused
+	pausedAt    time.Time     // when the slideshow timer was paused
+
+	failed        map[string]*FailedWallpaper // wallpapers that failed to load, by path
+	retryInterval time.Duration               // how long a failed wallpaper is skipped; 0 skips it forever
+
+	prefetch      *prefetcher // decodes upcoming wallpapers in the background
+	prefetchCount int         // how many upcoming wallpapers to decode ahead of time
+
+	outputRenderer   OutputRenderer         // the renderer, if it can show a different wallpaper on each output
+	outputMode       types.OutputMode       // whether outputs share a wallpaper or each show their own
+	outputs          []string               // names of the outputs, sorted
+	outputWallpapers map[string]string      // wallpaper shown on each output in the per-output modes
+	outputHistory    map[string][]string    // wallpapers previously shown on each output in the per-output modes, most recent last
+	outputForward    map[string][]string    // wallpapers each output stepped back over, replayed before its rotation continues
+	restoredOutputs  map[string]savedOutput // outputs restored from the last run that the renderer has not found yet
+	nextOutput       int                    // index into outputs of the output the staggered timer changes next
+
+	wallpaperDirs []string                // the global wallpaper directories
+	outputConfigs map[string]OutputConfig // settings that override the global ones, by lower case output name
+	outputChanged map[string]time.Time    // when each output with its own delay last changed
+
+	schedule       *schedule.Schedule // rules that change the wallpapers and timings by time of day
+	activeRule     *schedule.Rule     // the schedule rule in effect, nil when the global settings apply
+	scheduleSwitch bool               // whether the wallpaper still has to change to the rule in effect, as it came into effect while paused
+	shownFrame     string             // the time-lapse frame shown last
+	timelapseDirs  []string           // the time-lapse directories of the schedule rules, whose frames are not rotated
+
+	savedState   []byte    // the state as it was last saved, so it is only written when it changes
+	stateSavedAt time.Time // when the state was last saved
+	stateDirty   bool      // whether the state may have changed since it was last saved
+
+	strategy selection.Strategy // decides the order of wallpapers
 }
 
 // Renderer interface defines the methods that a renderer must implement to render
@@ -33,22 +103,60 @@ type Renderer interface {
 	Render() error                                             // Render the current image, called in a loop and will block for each frame
 	Cleanup()                                                  // Cleanup resources
 	GetSize() (int, int)                                       // Get the dimensions of the window
+	MaxTextureSize() int                                       // Get the largest texture dimension the GPU supports
+	Animating() bool                                           // Whether the wallpaper moves between changes, so Render must be called every frame
+	SetMotionPeriod(period time.Duration)                      // Set how long the pan and zoom of the images shown from now on lasts
 	IsDisplayRunning() bool
 	TryReconnect() error
 }
 
-// NewManager creates a new wallpaper manager with the specified wallpapers.
-func NewManager(wallpapers []string) *Manager {
+// OutputRenderer is implemented by renderers that can show a different image
+// on each output. Outputs are addressed by name.
+type OutputRenderer interface {
+	Outputs() []string                                                                       // Get the names of the outputs, sorted
+	SetOutputImage(output string, image image.Image) error                                   // Set the current image of one output
+	SetOutputScaleMode(output string, mode types.ScalingMode)                                // Scale images on one output differently
+	SetOutputMotionPeriod(output string, period time.Duration)                               // Set how long the pan and zoom of the images shown next on one output lasts
+	TransitionOutputs(next map[string]image.Image, durations map[string]time.Duration) error // Transition each output to its own next image
+}
+
+// NewManager creates a new wallpaper manager with the specified wallpapers,
+// found in dirs and in the directories of the output settings and schedule,
+// shown in the order strategy decides.
+func NewManager(wallpapers []string, dirs []string, outputs map[string]OutputConfig, sched *schedule.Schedule, strategy selection.Strategy) *Manager {
 	var renderer Renderer
 	var err error
 
+	trans := types.Transition(viper.GetString("transition"))
+	if !transition.Known(trans) {
+		log.Warnf("Unknown transition %q, fading instead", trans)
+		trans = types.TransitionFade
+	}
+
+	kb := kenBurnsConfig()
+	letterbox := letterboxColor()
+
+	// textures need a blurred backdrop if any output draws with fit-blur
+	outputBlur := false
+	for _, cfg := range outputs {
+		if types.ScalingMode(cfg.ScaleMode) == types.ScalingModeFitBlur {
+			outputBlur = true
+		}
+	}
+
 	if os.Getenv("XDG_SESSION_TYPE") == "wayland" {
 		log.Info("Detected Wayland session")
 
 		renderer, err = wlrenderer.NewRenderer(
 			types.ScalingMode(viper.GetString("scale_mode")),
+			letterbox,
 			types.EasingMode(viper.GetString("easing")),
+			trans,
+			kb,
 			viper.GetInt("framerate_limit"),
+			viper.GetInt("animation_framerate_limit"),
+			viper.GetInt("span_gap"),
+			outputBlur,
 		)
 		if err != nil {
 			log.Fatal("Failed to create wayland renderer:", err)
@@ -58,19 +166,118 @@ func NewManager(wallpapers []string) *Manager {
 
 		renderer, err = glxrenderer.NewRenderer(
 			types.ScalingMode(viper.GetString("scale_mode")),
+			letterbox,
 			types.EasingMode(viper.GetString("easing")),
+			trans,
+			kb,
 			viper.GetInt("framerate_limit"),
+			viper.GetInt("animation_framerate_limit"),
+			viper.GetInt("span_gap"),
 		)
 		if err != nil {
 			log.Fatal("Failed to create glx renderer:", err)
 		}
 	}
 
-	return &Manager{
-		wallpapers: wallpapers,
-		renderer:   renderer,
-		cmds:       make(chan Command, 1),
+	return newManager(renderer, wallpapers, dirs, outputs, sched, strategy)
+}
+
+// newManager creates a wallpaper manager that shows wallpapers with renderer,
+// as NewManager describes.
+func newManager(renderer Renderer, wallpapers []string, dirs []string, outputs map[string]OutputConfig, sched *schedule.Schedule, strategy selection.Strategy) *Manager {
+	m := &Manager{
+		wallpapers:       wallpapers,
+		renderer:         renderer,
+		cmds:             make(chan Command, 1),
+		failed:           make(map[string]*FailedWallpaper),
+		retryInterval:    time.Duration(viper.GetInt("retry_failed")) * time.Second,
+		prefetch:         newPrefetcher(int64(viper.GetInt("prefetch_memory")) << 20),
+		prefetchCount:    viper.GetInt("prefetch"),
+		outputMode:       types.OutputMode(viper.GetString("output_mode")),
+		outputWallpapers: make(map[string]string),
+		outputHistory:    make(map[string][]string),
+		outputForward:    make(map[string][]string),
+		wallpaperDirs:    dirs,
+		outputConfigs:    make(map[string]OutputConfig, len(outputs)),
+		outputChanged:    make(map[string]time.Time),
+		schedule:         sched,
+		strategy:         strategy,
+	}
+
+	for _, rule := range sched.Rules() {
+		if rule.Timelapse != "" {
+			m.timelapseDirs = append(m.timelapseDirs, rule.Timelapse)
+		}
+	}
+
+	m.outputRenderer, _ = renderer.(OutputRenderer)
+	for name, cfg := range outputs {
+		m.outputConfigs[strings.ToLower(name)] = cfg
 	}
+	if len(outputs) > 0 && m.outputRenderer == nil {
+		log.Warn("Output settings are not supported by this renderer, ignoring them")
+		clear(m.outputConfigs)
+	}
+	if m.outputMode == types.OutputModeSame && m.ownWallpapers() {
+		log.Info("Some outputs have their own wallpapers, delay or fade_speed, so each output shows its own wallpaper")
+		m.outputMode = types.OutputModeIndependent
+	}
+	if types.ScalingMode(viper.GetString("scale_mode")) == types.ScalingModeSpan && m.outputMode != types.OutputModeSame {
+		log.Warnf("output_mode %q and output settings cannot be used with the span scale_mode, showing the same wallpaper everywhere", m.outputMode)
+		m.outputMode = types.OutputModeSame
+		clear(m.outputConfigs)
+	}
+	switch m.outputMode {
+	case types.OutputModeSame:
+	case types.OutputModeIndependent, types.OutputModeStaggered:
+		if m.outputRenderer == nil {
+			log.Warnf("output_mode %q is not supported by this renderer, showing the same wallpaper everywhere", m.outputMode)
+			m.outputMode = types.OutputModeSame
+		}
+	default:
+		log.Warnf("Unknown output_mode %q, showing the same wallpaper everywhere", m.outputMode)
+		m.outputMode = types.OutputModeSame
+	}
+
+	return m
+}
+
+// kenBurnsConfig reads the Ken Burns settings. The period of the motion is
+// set as each wallpaper is shown, as motionPeriod works it out for the output
+// or schedule rule showing it.
+func kenBurnsConfig() kenburns.Config {
+	kb := kenburns.Config{
+		Enabled: viper.GetBool("ken_burns"),
+		MaxZoom: float32(viper.GetFloat64("ken_burns_zoom")),
+		Random:  viper.GetBool("ken_burns_random"),
+	}
+	if kb.Enabled && kb.MaxZoom <= 1 {
+		log.Warnf("ken_burns_zoom must be more than 1, not %v; using 1.2", kb.MaxZoom)
+		kb.MaxZoom = 1.2
+	}
+	return kb
+}
+
+// globalDelay reads the time between wallpaper changes, which defaults to 10
+// seconds.
+func globalDelay() time.Duration {
+	delay := viper.GetInt("delay")
+	if delay == 0 {
+		delay = 10
+	}
+	return time.Duration(delay) * time.Second
+}
+
+// letterboxColor reads the color of the bars around wallpapers that do not
+// fill the screen, given as "#rrggbb".
+func letterboxColor() color.RGBA {
+	s := viper.GetString("letterbox_color")
+	c := color.RGBA{A: 255}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(s) != 7 {
+		log.Warnf("letterbox_color must be given as \"#rrggbb\", not %q; using black", s)
+		return color.RGBA{A: 255}
+	}
+	return c
 }
 
 func (c *Manager) CurrentWallpaper() string {
@@ -107,78 +314,377 @@ func (c *Manager) SetWallpapers(wallpapers []string) {
 	c.Lock()
 	defer c.Unlock()
 	c.wallpapers = wallpapers
+	// the forward stacks refer to positions in the old rotation
+	c.forward = nil
+	clear(c.outputForward)
 }
 
+// NextWallpaper advances to the next wallpaper and returns it. If the user
+// has stepped back through the history, the wallpapers stepped over are
+// returned first so the original order is resumed.
 func (c *Manager) NextWallpaper() string {
+	return c.nextWallpaperFor("")
+}
+
+// nextWallpaperFor advances to the next wallpaper from the directories the
+// named output takes its wallpapers from, or from the global directories if
+// output is empty, and returns it. The wallpapers the output stepped back
+// over are returned first. Only the shared wallpaper is made current and kept
+// in the history; an output's wallpaper is recorded by the caller once it is
+// shown.
+func (c *Manager) nextWallpaperFor(output string) string {
 	c.Lock()
 	defer c.Unlock()
-	if len(c.wallpapers) == 0 {
-		return ""
+
+	accept := c.acceptFor(output)
+
+	forward := c.forwardFor(output)
+	next := ""
+	for i := len(forward) - 1; i >= 0 && next == ""; i-- {
+		w := forward[i]
+		if !accept(w) {
+			continue
+		}
+		forward = slices.Delete(forward, i, i+1)
+		if !c.isQuarantined(w) {
+			next = w
+		}
+	}
+	if output == "" {
+		c.forward = forward
+	} else {
+		c.outputForward[output] = forward
 	}
-	next := c.wallpapers[0]
-	c.wallpapers = append(c.wallpapers[1:], next)
 
+	// the strategy picks among the wallpapers that are not quarantined, then
+	// moves the one picked to the end and arranges the ones that come next
+	if next == "" {
+		i := c.strategy.Next(c.wallpapers, func(w string) bool {
+			return accept(w) && !c.isQuarantined(w)
+		})
+		if i >= 0 {
+			next = c.wallpapers[i]
+			c.strategy.Shown(c.wallpapers, i)
+		}
+	}
+	if next == "" || output != "" {
+		return next
+	}
+
+	c.pushHistory(c.currentWallpaper)
 	c.currentWallpaper = next
 
 	return next
 }
 
-func (c *Manager) Shuffle() {
+// upcomingWallpapers returns the wallpapers the next n changes will show,
+// each with the output it is scaled for, without advancing. In the per-output
+// modes a change gives a wallpaper to each output that changes next. The
+// wallpapers are picked as nextWallpaperFor picks them, so those of other
+// outputs or schedule rules are left out. It must be called from the render
+// thread.
+func (c *Manager) upcomingWallpapers(n int) []prefetchItem {
+	outputs := c.changingOutputs()
+	targets := make(map[string]resample.Target, len(outputs))
+	for _, name := range outputs {
+		if name == "" {
+			targets[name] = c.resampleTarget()
+		} else {
+			targets[name] = c.outputTarget(name)
+		}
+	}
+
 	c.Lock()
 	defer c.Unlock()
 
-	// Shuffle the wallpapers slice in place
-	rand.Shuffle(len(c.wallpapers), func(i, j int) {
-		c.wallpapers[i], c.wallpapers[j] = c.wallpapers[j], c.wallpapers[i]
-	})
+	candidates := make(map[string][]string, len(outputs))
+	for _, name := range outputs {
+		forward := c.forwardFor(name)
+		list := make([]string, 0, len(forward)+len(c.wallpapers))
+		for i := len(forward) - 1; i >= 0; i-- {
+			list = append(list, forward[i])
+		}
+		candidates[name] = append(list, c.wallpapers...)
+	}
+
+	taken := make(map[string]bool)
+	var upcoming []prefetchItem
+	for range n {
+		for _, name := range outputs {
+			accept := c.acceptFor(name)
+			for _, w := range candidates[name] {
+				if !taken[w] && accept(w) && !c.isQuarantined(w) {
+					taken[w] = true
+					upcoming = append(upcoming, prefetchItem{w, targets[name]})
+					break
+				}
+			}
+		}
+	}
+	return upcoming
+}
+
+// PreviousWallpaper steps back to the wallpaper shown before the current one
+// and returns it, or returns an empty string if there is no history.
+func (c *Manager) PreviousWallpaper() string {
+	c.Lock()
+	defer c.Unlock()
+
+	n := len(c.history)
+	if n == 0 {
+		return ""
+	}
+	prev := c.history[n-1]
+	c.history = c.history[:n-1]
+
+	if !c.isFrame(c.currentWallpaper) {
+		c.forward = append(c.forward, c.currentWallpaper)
+	}
+	c.currentWallpaper = prev
+
+	return prev
+}
+
+// forwardFor returns the wallpapers the named output stepped back over, or
+// those of the shared wallpaper if output is empty, most recent last. The
+// caller must hold the lock.
+func (c *Manager) forwardFor(output string) []string {
+	if output == "" {
+		return c.forward
+	}
+	return c.outputForward[output]
+}
+
+// pushHistory records a wallpaper as previously shown, dropping the oldest
+// entry once the history is full. Time-lapse frames are left out. The caller
+// must hold the lock.
+func (c *Manager) pushHistory(wallpaper string) {
+	if !c.isFrame(wallpaper) {
+		c.history = appendHistory(c.history, wallpaper)
+	}
+}
+
+// pushOutputHistory records a wallpaper as previously shown on the named
+// output, leaving time-lapse frames out. The caller must hold the lock.
+func (c *Manager) pushOutputHistory(output, wallpaper string) {
+	if !c.isFrame(wallpaper) {
+		c.outputHistory[output] = appendHistory(c.outputHistory[output], wallpaper)
+	}
+}
+
+// isFrame reports whether a wallpaper is a frame of a time-lapse. The caller
+// must hold the lock.
+func (c *Manager) isFrame(wallpaper string) bool {
+	return len(c.timelapseDirs) > 0 && inDirs(wallpaper, c.timelapseDirs)
+}
+
+// appendHistory appends a wallpaper to a history, dropping the oldest entry
+// once it holds historySize wallpapers.
+func appendHistory(history []string, wallpaper string) []string {
+	if wallpaper == "" {
+		return history
+	}
+	if len(history) >= historySize {
+		history = append(history[:0], history[len(history)-historySize+1:]...)
+	}
+	return append(history, wallpaper)
+}
+
+// resetTimer restarts the countdown to the next wallpaper change. If the
+// slideshow is paused, the full delay is kept for when it is resumed.
+func (c *Manager) resetTimer() {
+	c.Lock()
+	defer c.Unlock()
+	c.timeChanged = time.Now()
+	c.pausedAt = c.timeChanged
+}
+
+// Pause stops the slideshow timer, keeping the remaining time until the next
+// change so that Resume continues the countdown.
+func (c *Manager) Pause() {
+	c.Lock()
+	defer c.Unlock()
+	if c.paused {
+		return
+	}
+	c.paused = true
+	c.pausedAt = time.Now()
+}
+
+// Resume restarts a paused slideshow timer from where it was paused.
+func (c *Manager) Resume() {
+	c.Lock()
+	defer c.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	c.timeChanged = c.timeChanged.Add(time.Since(c.pausedAt))
+	for name, changed := range c.outputChanged {
+		c.outputChanged[name] = changed.Add(time.Since(c.pausedAt))
+	}
+}
+
+// TogglePause pauses a running slideshow or resumes a paused one.
+func (c *Manager) TogglePause() {
+	if c.Paused() {
+		c.Resume()
+	} else {
+		c.Pause()
+	}
+}
+
+// Paused reports whether the slideshow timer is paused.
+func (c *Manager) Paused() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.paused
+}
+
+// TimeRemaining returns the time left until the next wallpaper change. While
+// paused, the remaining time does not decrease.
+func (c *Manager) TimeRemaining() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if c.paused {
+		now = c.pausedAt
+	}
+	remaining := c.interval() - now.Sub(c.timeChanged)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// timerExpired reports whether the slideshow should advance.
+func (c *Manager) timerExpired() bool {
+	c.Lock()
+	defer c.Unlock()
+	return !c.paused && !c.timelapseActive() && time.Since(c.timeChanged) > c.interval()
+}
+
+// AddWallpapers adds new wallpapers to the rotation, where the selection
+// strategy places them. Wallpapers that are already in the rotation are
+// ignored.
+func (c *Manager) AddWallpapers(wallpapers []string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	known := make(map[string]bool, len(c.wallpapers))
+	for _, w := range c.wallpapers {
+		known[w] = true
+	}
+
+	added := 0
+	for _, w := range wallpapers {
+		// a file that was written again deserves another chance
+		delete(c.failed, w)
+		if known[w] {
+			continue
+		}
+		known[w] = true
+		added++
+		c.wallpapers = c.strategy.Insert(c.wallpapers, w)
+	}
+	return added
+}
+
+// RemoveWallpapers removes wallpapers from the rotation and the history. A
+// path may also be a directory, which removes every wallpaper below it. The
+// current wallpaper stays on screen until the next change.
+func (c *Manager) RemoveWallpapers(paths []string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	removed := func(w string) bool {
+		for _, p := range paths {
+			if w == p || strings.HasPrefix(w, p+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	before := len(c.wallpapers)
+	c.wallpapers = slices.DeleteFunc(c.wallpapers, removed)
+	c.history = slices.DeleteFunc(c.history, removed)
+	c.forward = slices.DeleteFunc(c.forward, removed)
+	for name, history := range c.outputHistory {
+		c.outputHistory[name] = slices.DeleteFunc(history, removed)
+	}
+	for name, forward := range c.outputForward {
+		c.outputForward[name] = slices.DeleteFunc(forward, removed)
+	}
+	maps.DeleteFunc(c.restoredOutputs, func(_ string, output savedOutput) bool { return removed(output.Current) })
+	maps.DeleteFunc(c.failed, func(w string, _ *FailedWallpaper) bool { return removed(w) })
+	return before - len(c.wallpapers)
+}
+
+// Arrange puts the wallpapers in the order the selection strategy shows a
+// newly loaded list in, such as shuffling them.
+func (c *Manager) Arrange() {
+	c.Lock()
+	defer c.Unlock()
+	c.strategy.Arrange(c.wallpapers)
 }
 
 // Run will block until it receives a signal to stop
 func (c *Manager) Run() {
 	log.Info("Starting wallpaper changer...")
 
-	timeChanged := time.Now()
-
-	// Set the initial wallpaper
-	c.NextWallpaper()
-	c.SetCurrent()
+	c.Lock()
+	c.delay = globalDelay()
+	c.Unlock()
+	c.applySchedule()
+	c.resetTimer()
 
-	delay := viper.GetInt("delay")
-	if delay == 0 {
-		delay = 10
+	// Set the initial wallpaper, or show the one restored from the last run
+	// again; in the per-output modes, each output is given its own as it is
+	// found
+	c.syncOutputs()
+	if !c.perOutput() {
+		if frame := c.dueFrame(); frame != "" {
+			c.SetCurrentWallpaper(frame)
+		} else if c.CurrentWallpaper() == "" {
+			c.NextWallpaper()
+		}
+		c.SetCurrent()
 	}
+	c.saveState()
 
 	running := true
 
 	for running {
+		idle := false
+		c.syncOutputs()
+		c.prefetch.Want(c.upcomingWallpapers(c.prefetchCount))
+
 		if len(c.cmds) > 0 {
-			cmd := <-c.cmds
-			switch cmd.Type {
-			case CommandStop:
-				log.Info("Stopping Wallpaper Manager ...")
+			if !c.handle(<-c.cmds) {
 				running = false
 				continue
-			case CommandNext:
-				log.Info("Received next command")
-				c.Next()
-				timeChanged = time.Now()
-			case CommandLoad:
-				log.Info("Received load command")
-				if len(cmd.Args) == 0 {
-					log.Error("No wallpapers specified for load command")
-					continue
-				}
-				c.SetWallpapers(cmd.Args)
-				log.Infof("Loaded %d wallpapers", len(cmd.Args))
-				c.Shuffle()
-				c.Next()
-				timeChanged = time.Now()
-			default:
-				log.Error("Unknown command:", cmd.Type)
 			}
-		} else if time.Since(timeChanged) > time.Duration(delay)*time.Second {
+		} else if c.applySchedule() {
+			// every output switches to the new rule's wallpapers at once
 			c.Next()
-			timeChanged = time.Now()
+			c.resetTimer()
+		} else if frame := c.dueFrame(); frame != "" {
+			c.showFrame(frame)
+			c.resetTimer()
+		} else if c.timerExpired() {
+			c.advance()
+			c.resetTimer()
+		} else if due := c.dueOutputs(); len(due) > 0 {
+			c.nextOutputs(due)
+		} else {
+			idle = true
+		}
+		if !idle {
+			c.stateDirty = true
+		}
+		if c.stateDirty && time.Since(c.stateSavedAt) >= stateSaveInterval {
+			c.saveState()
 		}
 
 		// Update the image so if the X server goes away and comes back the wallpaper
@@ -188,67 +694,309 @@ func (c *Manager) Run() {
 			log.Error("renderer.Render() failed:", err)
 		}
 
-		time.Sleep(500 * time.Millisecond)
+		// Render blocks for a frame; a still wallpaper needs far fewer
+		if !c.renderer.Animating() {
+			time.Sleep(500 * time.Millisecond)
+		}
 
 		if !c.renderer.IsDisplayRunning() {
-			log.Info("Display connection lost, attempting to reconnect...")
-			time.Sleep(1 * time.Second) // Wait a bit before reconnecting
-			for {
-				err = c.renderer.TryReconnect()
-				if err == nil {
-					log.Info("Display connection re-established")
-					break
-				}
-				log.Debug("Failed to reconnect to display:", err)
-				time.Sleep(1 * time.Second) // Wait a bit before retrying
+			log.Info("Display connection lost")
+			if !c.reconnect() {
+				running = false
+				continue
 			}
+			log.Info("Display connection re-established")
 			c.SetCurrent()
-			timeChanged = time.Now()
+			c.resetTimer()
 		}
 	}
 
+	c.saveState()
 	c.renderer.Cleanup()
 	log.Info("Wallpaper Manager stopped.")
 }
 
+// handle carries out a command from the queue, and reports whether the
+// manager keeps running.
+func (c *Manager) handle(cmd Command) bool {
+	switch cmd.Type {
+	case CommandStop:
+		log.Info("Stopping Wallpaper Manager ...")
+		return false
+	case CommandNext:
+		log.Info("Received next command")
+		c.Next()
+		c.resetTimer()
+	case CommandPrevious:
+		log.Info("Received previous command")
+		c.Previous()
+		c.resetTimer()
+	case CommandSet:
+		log.Info("Received set command")
+		if len(cmd.Args) != 1 {
+			log.Error("Set command requires exactly one wallpaper")
+			cmd.reply(errors.New("set requires exactly one wallpaper"))
+			return true
+		}
+		cmd.reply(c.Set(cmd.Args[0]))
+		c.resetTimer()
+	case CommandAdd:
+		added := c.AddWallpapers(cmd.Args)
+		log.Infof("Added %d new wallpapers", added)
+	case CommandRemove:
+		removed := c.RemoveWallpapers(cmd.Args)
+		log.Infof("Removed %d wallpapers", removed)
+	case CommandPause:
+		log.Info("Received pause command")
+		c.Pause()
+	case CommandResume:
+		log.Info("Received resume command")
+		c.Resume()
+	case CommandTogglePause:
+		log.Info("Received toggle command")
+		c.TogglePause()
+	case CommandLoad:
+		log.Info("Received load command")
+		if len(cmd.Args) == 0 {
+			log.Error("No wallpapers specified for load command")
+			return true
+		}
+		c.SetWallpapers(cmd.Args)
+		log.Infof("Loaded %d wallpapers", len(cmd.Args))
+		c.Arrange()
+		c.Next()
+		c.resetTimer()
+	default:
+		log.Error("Unknown command:", cmd.Type)
+	}
+	return true
+}
+
+// reconnect tries to connect to the display again, waiting twice as long after
+// each failed attempt up to reconnectBackoffMax. It returns false, so that the
+// manager exits, if on_disconnect says not to reconnect, once logind says the
+// session has ended, or once reconnect_timeout seconds have passed if that is
+// set. At least one attempt is always made. A missing Wayland socket only
+// ends the session once it has stayed missing for reconnect_timeout, or
+// socketGoneTimeout without one, so that a restarting compositor is waited
+// for.
+func (c *Manager) reconnect() bool {
+	switch policy := types.DisconnectPolicy(viper.GetString("on_disconnect")); policy {
+	case types.DisconnectReconnect:
+	case types.DisconnectExit:
+		log.Info("Display connection lost, exiting")
+		return false
+	default:
+		log.Warnf("Unknown on_disconnect %q, reconnecting", policy)
+	}
+
+	timeout := time.Duration(viper.GetInt("reconnect_timeout")) * time.Second
+	socketTimeout := timeout
+	if socketTimeout <= 0 {
+		socketTimeout = socketGoneTimeout
+	}
+	start := time.Now()
+	var socketGoneAt time.Time
+	backoff := reconnectBackoffMin
+	for {
+		time.Sleep(backoff)
+		err := c.renderer.TryReconnect()
+		if err == nil {
+			return true
+		}
+		log.Debug("Failed to reconnect to display:", err)
+
+		if ended, reason := session.Ended(); ended {
+			log.Infof("Session has ended (%v), exiting", reason)
+			return false
+		}
+		if gone, socket := session.SocketGone(); !gone {
+			socketGoneAt = time.Time{}
+		} else if socketGoneAt.IsZero() {
+			socketGoneAt = time.Now()
+		} else if time.Since(socketGoneAt) >= socketTimeout {
+			log.Infof("Session has ended (wayland socket %v has been gone for %v), exiting", socket, socketTimeout)
+			return false
+		}
+
+		if timeout > 0 && time.Since(start) >= timeout {
+			log.Errorf("Display did not come back within %v, exiting", timeout)
+			return false
+		}
+		backoff = min(backoff*2, reconnectBackoffMax)
+	}
+}
+
+// Next transitions to the next wallpaper in the rotation. Wallpapers that fail
+// to load are quarantined and skipped. In the per-output modes every output
+// changes to its own next wallpaper.
 func (c *Manager) Next() {
-	nextFile := c.NextWallpaper()
-	if nextFile == "" {
-		log.Fatal("No next wallpaper found")
-		os.Exit(1)
+	if c.perOutput() {
+		c.nextOutputs(c.Outputs())
+		return
+	}
+
+	for range len(c.GetWallpapers()) + 1 {
+		prevFile := c.CurrentWallpaper()
+		nextFile := c.NextWallpaper()
+		if nextFile == "" {
+			break
+		}
+
+		if err := c.transitionTo(nextFile); err != nil {
+			c.quarantine(nextFile, err)
+			c.restoreCurrent(prevFile, &c.history)
+			continue
+		}
+		return
+	}
+
+	log.Warn("No wallpapers available, keeping the current one")
+}
+
+// Previous transitions back to the previously shown wallpaper, if any. In the
+// per-output modes every output steps back through its own history.
+func (c *Manager) Previous() {
+	if c.perOutput() {
+		c.previousOutputs()
+		return
 	}
 
-	nextImgData, err := os.ReadFile(nextFile)
+	currentFile := c.CurrentWallpaper()
+	prevFile := c.PreviousWallpaper()
+	if prevFile == "" {
+		log.Info("No previous wallpaper in history")
+		return
+	}
+
+	if err := c.transitionTo(prevFile); err != nil {
+		c.quarantine(prevFile, err)
+		c.restoreCurrent(currentFile, &c.forward)
+	}
+}
+
+// Set transitions straight to the given wallpaper without changing the
+// playlist. The wallpaper it replaces is kept in the history, and the
+// wallpapers stepped back over are forgotten, as the history no longer leads
+// back to them. It returns the error if the wallpaper could not be loaded,
+// and only quarantines it if it is one of the wallpapers in the rotation.
+func (c *Manager) Set(file string) error {
+	c.Lock()
+	currentFile := c.currentWallpaper
+	c.pushHistory(c.currentWallpaper)
+	c.currentWallpaper = file
+	c.Unlock()
+
+	if err := c.transitionTo(file); err != nil {
+		c.Lock()
+		inRotation := slices.Contains(c.wallpapers, file)
+		c.Unlock()
+		if inRotation {
+			c.quarantine(file, err)
+		}
+		c.restoreCurrent(currentFile, &c.history)
+		return err
+	}
+
+	c.Lock()
+	c.forward = nil
+	clear(c.outputForward)
+	c.Unlock()
+	return nil
+}
+
+// showFrame fades every output to a frame of the time-lapse in effect. The
+// frames follow the sun rather than the user, so they are kept out of the
+// history and the wallpapers stepped back over are kept. A frame that fails
+// to load is not quarantined, as the next frame replaces it soon enough.
+func (c *Manager) showFrame(frame string) {
+	img, err := c.prepare(frame, c.resampleTarget())
 	if err != nil {
-		log.Fatal("Failed to read next image file:", err)
-		os.Exit(1)
+		log.Errorf("Failed to load time-lapse frame %v: %v", frame, err)
+		return
+	}
+
+	c.Lock()
+	c.currentWallpaper = frame
+	for _, name := range c.outputs {
+		c.outputWallpapers[name] = frame
+		c.outputChangedNow(name)
+	}
+	fade := c.fadeSpeed("")
+	period := c.motionPeriod("")
+	c.Unlock()
+
+	c.renderer.SetMotionPeriod(period)
+	if err := c.renderer.Transition(img, fade); err != nil {
+		log.Errorf("Failed to transition images: %v", err)
 	}
-	nextImg, _, err := image.Decode(bytes.NewReader(nextImgData))
+}
+
+// transitionTo loads the given file and fades every output to it. An error
+// is only returned if the file could not be loaded.
+func (c *Manager) transitionTo(nextFile string) error {
+	nextImg, err := c.prepare(nextFile, c.resampleTarget())
 	if err != nil {
-		log.Fatal("Failed to decode next image:", err)
-		os.Exit(1)
+		return err
+	}
+
+	c.Lock()
+	for _, name := range c.outputs {
+		if c.outputMode != types.OutputModeSame {
+			c.pushOutputHistory(name, c.outputWallpapers[name])
+		}
+		c.outputWallpapers[name] = nextFile
+		c.outputChangedNow(name)
 	}
-	log.Infof("loading %v (%vx%v)", nextFile, nextImg.Bounds().Max.X, nextImg.Bounds().Max.Y)
+	fade := c.fadeSpeed("")
+	period := c.motionPeriod("")
+	c.Unlock()
 
-	err = c.renderer.Transition(nextImg, time.Duration(viper.GetInt("fade_speed"))*time.Second)
+	c.renderer.SetMotionPeriod(period)
+	err = c.renderer.Transition(nextImg, fade)
 	if err != nil {
 		log.Errorf("Failed to transition images: %v", err)
 	}
+	return nil
+}
+
+// prepare returns the given file scaled for the target, taking it from the
+// prefetched images if it is there.
+func (c *Manager) prepare(file string, target resample.Target) (image.Image, error) {
+	var img image.Image
+	if prefetched, ok := c.prefetch.Take(file, target); ok {
+		img = prefetched
+	} else {
+		loaded, err := loadImage(file)
+		if err != nil {
+			return nil, err
+		}
+		img = resample.Fit(loaded, target)
+	}
+	c.clearFailure(file)
+	log.Infof("loading %v (%vx%v)", file, img.Bounds().Max.X, img.Bounds().Max.Y)
+	return img, nil
 }
 
 func (c *Manager) SetCurrent() {
-	log.Infof("Setting current wallpaper: %s", c.CurrentWallpaper())
-	imgData, err := os.ReadFile(c.CurrentWallpaper())
-	if err != nil {
-		log.Error("Failed to read current image file:", err)
+	if c.perOutput() {
+		c.setCurrentOutputs()
 		return
 	}
-	img, _, err := image.Decode(bytes.NewReader(imgData))
+
+	log.Infof("Setting current wallpaper: %s", c.CurrentWallpaper())
+	img, err := loadImage(c.CurrentWallpaper())
 	if err != nil {
-		log.Error("Failed to decode current image:", err)
+		log.Error("Failed to load current image:", err)
+		c.quarantine(c.CurrentWallpaper(), err)
+		c.Next()
 		return
 	}
-	err = c.renderer.SetImage(img)
+	c.Lock()
+	period := c.motionPeriod("")
+	c.Unlock()
+	c.renderer.SetMotionPeriod(period)
+	err = c.renderer.SetImage(resample.Fit(img, c.resampleTarget()))
 	if err != nil {
 		log.Error("Failed to set current image:", err)
 		return
@@ -257,9 +1005,35 @@ func (c *Manager) SetCurrent() {
 	c.renderer.Render()
 }
 
+// EnqueueCommand queues a command for the Run loop. It blocks while the queue
+// is full, so it must not hold the manager lock, which the Run loop needs to
+// make progress.
 func (c *Manager) EnqueueCommand(cmd Command) {
-	c.Lock()
-	defer c.Unlock()
-
 	c.cmds <- cmd
 }
+
+// resampleTarget describes the largest output, so images can be scaled down
+// to the size they are displayed at before they are uploaded. It must be
+// called from the render thread.
+func (c *Manager) resampleTarget() resample.Target {
+	w, h := c.renderer.GetSize()
+	return resample.Target{
+		Width:          w,
+		Height:         h,
+		ScaleMode:      types.ScalingMode(viper.GetString("scale_mode")),
+		MaxTextureSize: c.renderer.MaxTextureSize(),
+	}
+}
+
+// loadImage reads and decodes the image at the given path.
+func loadImage(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %w", path, err)
+	}
+	img, err := imageformat.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %w", path, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,387 @@
+package ipc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/matjam/smoothpaper/internal/schedule"
+	"github.com/matjam/smoothpaper/internal/selection"
+	"github.com/matjam/smoothpaper/internal/solar"
+	"github.com/matjam/smoothpaper/internal/types"
+	"github.com/spf13/viper"
+)
+
+// fakeRenderer records what the manager asks it to show instead of drawing.
+type fakeRenderer struct {
+	outputs       []string
+	scaleModes    map[string]types.ScalingMode // scale modes set for outputs
+	period        time.Duration                // motion period of the images shown on every output
+	outputPeriods map[string]time.Duration     // motion periods of the images shown on one output
+	transitions   int                          // number of transitions, to every output or to some
+	images        int                          // number of images shown without a transition
+}
+
+func newFakeRenderer(outputs ...string) *fakeRenderer {
+	return &fakeRenderer{
+		outputs:       outputs,
+		scaleModes:    make(map[string]types.ScalingMode),
+		outputPeriods: make(map[string]time.Duration),
+	}
+}
+
+func (r *fakeRenderer) SetImage(image.Image) error                  { r.images++; return nil }
+func (r *fakeRenderer) Transition(image.Image, time.Duration) error { r.transitions++; return nil }
+func (r *fakeRenderer) Render() error                               { return nil }
+func (r *fakeRenderer) Cleanup()                                    {}
+func (r *fakeRenderer) GetSize() (int, int)                         { return 64, 48 }
+func (r *fakeRenderer) MaxTextureSize() int                         { return 4096 }
+func (r *fakeRenderer) Animating() bool                             { return false }
+func (r *fakeRenderer) IsDisplayRunning() bool                      { return true }
+func (r *fakeRenderer) TryReconnect() error                         { return nil }
+func (r *fakeRenderer) SetMotionPeriod(period time.Duration)        { r.period = period }
+
+func (r *fakeRenderer) Outputs() []string { return r.outputs }
+
+func (r *fakeRenderer) SetOutputImage(string, image.Image) error { r.images++; return nil }
+
+func (r *fakeRenderer) SetOutputScaleMode(output string, mode types.ScalingMode) {
+	r.scaleModes[output] = mode
+}
+
+func (r *fakeRenderer) SetOutputMotionPeriod(output string, period time.Duration) {
+	r.outputPeriods[output] = period
+}
+
+func (r *fakeRenderer) TransitionOutputs(map[string]image.Image, map[string]time.Duration) error {
+	r.transitions++
+	return nil
+}
+
+// writeWallpapers writes n small PNG files to a temporary directory and
+// returns their paths, in order.
+func writeWallpapers(t *testing.T, n int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		img.Set(0, 0, color.RGBA{R: uint8(i), A: 255})
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%02d.png", i))
+		f, err := os.Create(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return paths
+}
+
+// newTestManager returns a manager that shows wallpapers in order with
+// renderer, and saves its state to a temporary directory. settings are set
+// in viper for the test. sched may be nil for no schedule.
+func newTestManager(t *testing.T, renderer Renderer, wallpapers []string, outputs map[string]OutputConfig, sched *schedule.Schedule, settings map[string]any) *Manager {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("delay", 60)
+	viper.Set("fade_speed", 1)
+	viper.Set("scale_mode", "fit")
+	viper.Set("output_mode", "same")
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+
+	if sched == nil {
+		var err error
+		if sched, err = schedule.New(nil, nil, time.Now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	strategy, err := selection.New(types.SelectionSequential, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the manager rearranges the list it is given
+	m := newManager(renderer, slices.Clone(wallpapers), []string{filepath.Dir(wallpapers[0])}, outputs, sched, strategy)
+	m.delay = globalDelay()
+	return m
+}
+
+func TestOutputScaleModes(t *testing.T) {
+	r := newFakeRenderer("DP-1", "HDMI-1", "eDP-1")
+	m := newTestManager(t, r, writeWallpapers(t, 2), map[string]OutputConfig{
+		"DP-1":  {ScaleMode: "tile"},
+		"eDP-1": {ScaleMode: "span"},
+	}, nil, map[string]any{"scale_mode": "fill"})
+
+	m.syncOutputs()
+
+	if got := r.scaleModes["DP-1"]; got != types.ScalingModeTile {
+		t.Errorf("DP-1 scale mode = %q, want its own %q", got, types.ScalingModeTile)
+	}
+	for _, name := range []string{"HDMI-1", "eDP-1"} {
+		if mode, ok := r.scaleModes[name]; ok {
+			t.Errorf("%v was given the scale mode %q, want it left with the global one", name, mode)
+		}
+		if got := m.outputTarget(name).ScaleMode; got != types.ScalingModeFill {
+			t.Errorf("%v scales images for %q, want the global %q", name, got, types.ScalingModeFill)
+		}
+	}
+}
+
+func TestTimelapseFrames(t *testing.T) {
+	frames := writeWallpapers(t, 4)
+	// just after solar noon on the equinox at the prime meridian, when the
+	// sun starts to sink and the third of the four frames is shown
+	noon := func() time.Time { return time.Date(2025, time.March, 20, 12, 30, 0, 0, time.UTC) }
+	sched, err := schedule.New([]schedule.Rule{{
+		Name:      "time-lapse",
+		Timelapse: filepath.Dir(frames[0]),
+		Frames:    frames,
+	}}, &solar.Location{}, noon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallpapers := writeWallpapers(t, 3)
+	r := newFakeRenderer()
+	m := newTestManager(t, r, wallpapers, nil, sched, nil)
+	m.history = []string{wallpapers[0]}
+	m.currentWallpaper = wallpapers[1]
+	m.forward = []string{wallpapers[2]}
+
+	m.applySchedule()
+	frame := m.dueFrame()
+	if frame != frames[2] {
+		t.Fatalf("due frame = %v, want %v", frame, frames[2])
+	}
+	m.showFrame(frame)
+
+	if m.CurrentWallpaper() != frame || r.transitions != 1 {
+		t.Errorf("showing %v after %d transitions, want %v after 1", m.CurrentWallpaper(), r.transitions, frame)
+	}
+	if !slices.Equal(m.history, []string{wallpapers[0]}) || !slices.Equal(m.forward, []string{wallpapers[2]}) {
+		t.Errorf("history %v and forward %v changed, want %v and %v", m.history, m.forward, wallpapers[:1], wallpapers[2:])
+	}
+
+	// a frame that fails to load is skipped without quarantining it
+	if err := os.WriteFile(frames[3], []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.showFrame(frames[3])
+	if m.CurrentWallpaper() != frame {
+		t.Errorf("showing %v after a frame failed to load, want %v kept", m.CurrentWallpaper(), frame)
+	}
+	if failed := m.FailedWallpapers(); len(failed) > 0 {
+		t.Errorf("quarantined %v, want frames left out of the quarantine", failed)
+	}
+
+	// stepping back leaves the frame out of the wallpapers stepped over
+	m.Previous()
+	if m.CurrentWallpaper() != wallpapers[0] || !slices.Equal(m.forward, []string{wallpapers[2]}) {
+		t.Errorf("stepped back to %v with forward %v, want %v with %v", m.CurrentWallpaper(), m.forward, wallpapers[0], wallpapers[2:])
+	}
+}
+
+func TestSetFailureQuarantinesOnlyRotation(t *testing.T) {
+	wallpapers := writeWallpapers(t, 2)
+	outside := filepath.Join(t.TempDir(), "outside.png")
+	for _, path := range []string{wallpapers[1], outside} {
+		if err := os.WriteFile(path, []byte("not an image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newTestManager(t, newFakeRenderer(), wallpapers, nil, nil, nil)
+	m.currentWallpaper = wallpapers[0]
+
+	for _, path := range []string{outside, wallpapers[1]} {
+		if err := m.Set(path); err == nil {
+			t.Errorf("Set(%v) succeeded, want the load error", path)
+		}
+		if m.CurrentWallpaper() != wallpapers[0] || len(m.history) > 0 {
+			t.Errorf("showing %v with history %v after a failed set, want %v with none", m.CurrentWallpaper(), m.history, wallpapers[0])
+		}
+	}
+	failed := m.FailedWallpapers()
+	if len(failed) != 1 || failed[0].Path != wallpapers[1] {
+		t.Errorf("quarantined %v, want only %v", failed, wallpapers[1])
+	}
+}
+
+func TestPreviousFailureRestoresStacks(t *testing.T) {
+	wallpapers := writeWallpapers(t, 2)
+	if err := os.WriteFile(wallpapers[1], []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestManager(t, newFakeRenderer(), wallpapers, nil, nil, nil)
+	// the wallpaper shown now was also shown before the one stepped back to
+	m.history = []string{wallpapers[0], wallpapers[1]}
+	m.currentWallpaper = wallpapers[0]
+
+	m.Previous()
+
+	if m.CurrentWallpaper() != wallpapers[0] {
+		t.Errorf("showing %v, want %v kept", m.CurrentWallpaper(), wallpapers[0])
+	}
+	if !slices.Equal(m.history, wallpapers[:1]) || len(m.forward) > 0 {
+		t.Errorf("history %v and forward %v, want %v and none", m.history, m.forward, wallpapers[:1])
+	}
+}
+
+func TestMotionPeriods(t *testing.T) {
+	r := newFakeRenderer("DP-1", "HDMI-1")
+	m := newTestManager(t, r, writeWallpapers(t, 4), map[string]OutputConfig{
+		"DP-1": {Delay: 300, FadeSpeed: 5},
+	}, nil, map[string]any{"delay": 30, "fade_speed": 2})
+	m.syncOutputs()
+
+	m.nextOutputs(m.Outputs())
+	if got := r.outputPeriods["DP-1"]; got != 305*time.Second {
+		t.Errorf("DP-1 motion lasts %v, want its own delay and fade of 305s", got)
+	}
+	if got := r.outputPeriods["HDMI-1"]; got != 32*time.Second {
+		t.Errorf("HDMI-1 motion lasts %v, want the global delay and fade of 32s", got)
+	}
+}
+
+func TestMotionPeriodOfRule(t *testing.T) {
+	sched, err := schedule.New([]schedule.Rule{{Name: "all day", Delay: 120, FadeSpeed: 4}}, nil, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeRenderer()
+	m := newTestManager(t, r, writeWallpapers(t, 2), nil, sched, nil)
+
+	m.applySchedule()
+	m.Next()
+	if r.period != 124*time.Second {
+		t.Errorf("motion lasts %v, want the rule's delay and fade of 124s", r.period)
+	}
+}
+
+func TestSetCommand(t *testing.T) {
+	wallpapers := writeWallpapers(t, 3)
+	outside := writeWallpapers(t, 1)[0]
+	m := newTestManager(t, newFakeRenderer(), wallpapers, nil, nil, nil)
+	m.Next()
+	m.Next()
+	m.Previous()
+	playlist := slices.Clone(m.GetWallpapers())
+	// the timer has nearly run out
+	m.timeChanged = time.Now().Add(-55 * time.Second)
+
+	done := make(chan error, 1)
+	m.handle(Command{Type: CommandSet, Args: []string{outside}, Done: done})
+
+	if err := <-done; err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if m.CurrentWallpaper() != outside {
+		t.Errorf("showing %v, want %v", m.CurrentWallpaper(), outside)
+	}
+	if got := m.GetWallpapers(); !slices.Equal(got, playlist) {
+		t.Errorf("playlist %v after a set, want it unchanged as %v", got, playlist)
+	}
+	if len(m.forward) > 0 {
+		t.Errorf("forward %v after a set, want it cleared", m.forward)
+	}
+	if !slices.Equal(m.history, wallpapers[:1]) {
+		t.Errorf("history %v, want the wallpaper replaced, %v", m.history, wallpapers[:1])
+	}
+	if remaining := m.TimeRemaining(); remaining < 59*time.Second {
+		t.Errorf("%v until the next change, want the timer reset to 60s", remaining)
+	}
+}
+
+func TestPreviousAndForward(t *testing.T) {
+	wallpapers := writeWallpapers(t, 4)
+	m := newTestManager(t, newFakeRenderer(), wallpapers, nil, nil, nil)
+	for range 3 {
+		m.Next()
+	}
+
+	m.Previous()
+	m.Previous()
+	if m.CurrentWallpaper() != wallpapers[0] {
+		t.Errorf("stepped back to %v, want %v", m.CurrentWallpaper(), wallpapers[0])
+	}
+	if !slices.Equal(m.forward, []string{wallpapers[2], wallpapers[1]}) {
+		t.Errorf("forward %v, want the wallpapers stepped over, most recent last", m.forward)
+	}
+
+	// the wallpapers stepped back over come first, then the rotation carries on
+	var shown []string
+	for range 3 {
+		m.Next()
+		shown = append(shown, m.CurrentWallpaper())
+	}
+	if !slices.Equal(shown, wallpapers[1:]) {
+		t.Errorf("showed %v going forward, want %v", shown, wallpapers[1:])
+	}
+	if !slices.Equal(m.history, wallpapers[:3]) {
+		t.Errorf("history %v, want %v", m.history, wallpapers[:3])
+	}
+}
+
+func TestPauseKeepsTimeRemaining(t *testing.T) {
+	m := newTestManager(t, newFakeRenderer(), writeWallpapers(t, 2), nil, nil, nil)
+	m.resetTimer()
+	m.timeChanged = m.timeChanged.Add(-20 * time.Second)
+
+	m.Pause()
+	// while paused, the time spent does not count
+	m.pausedAt = m.pausedAt.Add(-time.Hour)
+	m.timeChanged = m.timeChanged.Add(-time.Hour)
+	if remaining := m.TimeRemaining(); remaining < 39*time.Second || remaining > 40*time.Second {
+		t.Errorf("%v remaining while paused, want 40s", remaining)
+	}
+	if m.timerExpired() {
+		t.Error("timer expired while paused")
+	}
+
+	m.Resume()
+	if remaining := m.TimeRemaining(); remaining < 39*time.Second || remaining > 40*time.Second {
+		t.Errorf("%v remaining after resuming, want the 40s left when paused", remaining)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	wallpapers := writeWallpapers(t, 5)
+	m := newTestManager(t, newFakeRenderer(), wallpapers[:4], nil, nil, nil)
+	for range 3 {
+		m.Next()
+	}
+	m.Previous()
+	m.saveState()
+
+	// since the last run, wallpapers[0] was deleted and wallpapers[4] added
+	found := wallpapers[1:]
+	restored := newManager(newFakeRenderer(), slices.Clone(found), nil, nil, m.schedule, m.strategy)
+	if !restored.RestoreState() {
+		t.Fatal("no saved state restored")
+	}
+
+	if restored.CurrentWallpaper() != wallpapers[1] {
+		t.Errorf("current %v, want %v", restored.CurrentWallpaper(), wallpapers[1])
+	}
+	if len(restored.history) > 0 {
+		t.Errorf("history %v, want the deleted wallpaper dropped", restored.history)
+	}
+	if !slices.Equal(restored.forward, wallpapers[2:3]) {
+		t.Errorf("forward %v, want %v", restored.forward, wallpapers[2:3])
+	}
+	got := restored.GetWallpapers()
+	if want := []string{wallpapers[3], wallpapers[1], wallpapers[2], wallpapers[4]}; !slices.Equal(got, want) {
+		t.Errorf("rotation %v, want the saved order without the deleted wallpaper and with the new one, %v", got, want)
+	}
+}
@@ -0,0 +1,506 @@
+package ipc
+
+import (
+	"image"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/resample"
+	"github.com/matjam/smoothpaper/internal/types"
+	"github.com/spf13/viper"
+)
+
+// OutputConfig holds the settings of one output, from an [outputs."NAME"]
+// section of the configuration. Settings left unset use the global ones.
+type OutputConfig struct {
+	Wallpapers []string `mapstructure:"wallpapers"` // directories the output takes its wallpapers from
+	ScaleMode  string   `mapstructure:"scale_mode"` // how images are scaled onto the output
+	Delay      int      `mapstructure:"delay"`      // seconds between wallpaper changes on the output
+	FadeSpeed  int      `mapstructure:"fade_speed"` // seconds the output takes to fade to the next wallpaper
+}
+
+// outputConfig returns the settings of the named output. Output names are
+// matched without regard to case, as the configuration keys are lower case.
+// The caller must hold the lock.
+func (c *Manager) outputConfig(name string) OutputConfig {
+	return c.outputConfigs[strings.ToLower(name)]
+}
+
+// ownWallpapers reports whether any output has settings that stop it from
+// showing the same wallpaper as the others. The caller must hold the lock.
+func (c *Manager) ownWallpapers() bool {
+	for _, cfg := range c.outputConfigs {
+		if len(cfg.Wallpapers) > 0 || cfg.Delay > 0 || cfg.FadeSpeed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptFor returns a function reporting whether a wallpaper may be shown on
+// the named output. An output with directories of its own only shows the
+// wallpapers in them. Any other output, or an empty name, shows those of the
+// schedule rule in effect if it has directories, and otherwise wallpapers
+// from anywhere but the directories that belong to particular outputs or
+// schedule rules. The frames of time-lapses are never shown in the rotation,
+// even if they lie in a wallpaper directory. The caller must hold the lock.
+func (c *Manager) acceptFor(output string) func(string) bool {
+	accept := c.acceptDirs(output)
+	if len(c.timelapseDirs) == 0 {
+		return accept
+	}
+	return func(path string) bool { return !c.isFrame(path) && accept(path) }
+}
+
+// acceptDirs returns a function reporting whether a wallpaper is in the
+// directories the named output takes its wallpapers from, as acceptFor
+// describes. The caller must hold the lock.
+func (c *Manager) acceptDirs(output string) func(string) bool {
+	if output != "" {
+		if dirs := c.outputConfig(output).Wallpapers; len(dirs) > 0 {
+			return func(path string) bool { return inDirs(path, dirs) }
+		}
+	}
+	if c.activeRule != nil && len(c.activeRule.Wallpapers) > 0 {
+		dirs := c.activeRule.Wallpapers
+		return func(path string) bool { return inDirs(path, dirs) }
+	}
+	own := c.scheduleDirs()
+	for _, cfg := range c.outputConfigs {
+		own = append(own, cfg.Wallpapers...)
+	}
+	if len(own) == 0 {
+		return func(string) bool { return true }
+	}
+	return func(path string) bool {
+		return inDirs(path, c.wallpaperDirs) || !inDirs(path, own)
+	}
+}
+
+// inDirs reports whether path is one of dirs or lies beneath one of them.
+func inDirs(path string, dirs []string) bool {
+	path = filepath.Clean(path)
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fadeSpeed returns how long the named output takes to fade to its next
+// wallpaper, or how long every output takes if output is empty. The caller
+// must hold the lock.
+func (c *Manager) fadeSpeed(output string) time.Duration {
+	if s := c.outputConfig(output).FadeSpeed; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if c.activeRule != nil && c.activeRule.FadeSpeed > 0 {
+		return time.Duration(c.activeRule.FadeSpeed) * time.Second
+	}
+	return time.Duration(viper.GetInt("fade_speed")) * time.Second
+}
+
+// motionPeriod returns how long a wallpaper shown on the named output, or on
+// every output if output is empty, pans and zooms for: the delay it is shown
+// for, the output's own or that of the schedule rule in effect, and then the
+// fade to the next one. The caller must hold the lock.
+func (c *Manager) motionPeriod(output string) time.Duration {
+	delay := c.delay
+	if d := c.outputConfig(output).Delay; d > 0 {
+		delay = time.Duration(d) * time.Second
+	}
+	return delay + c.fadeSpeed(output)
+}
+
+// outputTarget describes the output images are scaled down for, using the
+// named output's scale mode. It must be called from the render thread.
+func (c *Manager) outputTarget(output string) resample.Target {
+	target := c.resampleTarget()
+	c.Lock()
+	if mode := c.outputScaleMode(output); mode != "" {
+		target.ScaleMode = mode
+	}
+	c.Unlock()
+	return target
+}
+
+// outputScaleMode returns the scale mode the named output has instead of the
+// global one, or "" if it uses the global one. The span scale mode covers
+// every output, so one output cannot have it. The caller must hold the lock.
+func (c *Manager) outputScaleMode(output string) types.ScalingMode {
+	mode := types.ScalingMode(c.outputConfig(output).ScaleMode)
+	if mode == types.ScalingModeSpan {
+		return ""
+	}
+	return mode
+}
+
+// sharedOutputs returns the outputs that change on the global timer, which
+// are those without a delay of their own. The caller must hold the lock.
+func (c *Manager) sharedOutputs() []string {
+	var shared []string
+	for _, name := range c.outputs {
+		if c.outputConfig(name).Delay <= 0 {
+			shared = append(shared, name)
+		}
+	}
+	return shared
+}
+
+// dueOutputs returns the outputs with a delay of their own whose wallpaper
+// has been shown for at least that long.
+func (c *Manager) dueOutputs() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.paused || c.outputMode == types.OutputModeSame {
+		return nil
+	}
+	var due []string
+	for _, name := range c.outputs {
+		delay := time.Duration(c.outputConfig(name).Delay) * time.Second
+		if delay <= 0 {
+			continue
+		}
+		changed, ok := c.outputChanged[name]
+		if ok && time.Since(changed) > delay {
+			due = append(due, name)
+		}
+	}
+	return due
+}
+
+// outputChangedNow restarts the timer of the named output if it has a delay
+// of its own. The caller must hold the lock.
+func (c *Manager) outputChangedNow(output string) {
+	if c.outputConfig(output).Delay > 0 {
+		c.outputChanged[output] = time.Now()
+	}
+}
+
+// perOutput reports whether each output shows its own wallpaper.
+func (c *Manager) perOutput() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.outputMode != types.OutputModeSame
+}
+
+// Outputs returns the names of the outputs, or nil if the renderer does not
+// tell them apart.
+func (c *Manager) Outputs() []string {
+	c.Lock()
+	defer c.Unlock()
+	return slices.Clone(c.outputs)
+}
+
+// OutputWallpapers returns the wallpaper shown on each output.
+func (c *Manager) OutputWallpapers() map[string]string {
+	c.Lock()
+	defer c.Unlock()
+
+	wallpapers := make(map[string]string, len(c.outputs))
+	for _, name := range c.outputs {
+		if c.outputMode == types.OutputModeSame {
+			wallpapers[name] = c.currentWallpaper
+		} else {
+			wallpapers[name] = c.outputWallpapers[name]
+		}
+	}
+	return wallpapers
+}
+
+// interval returns the time between wallpaper changes. In the staggered mode
+// the outputs take turns, so the timer fires once per output in each delay
+// period. The caller must hold the lock.
+func (c *Manager) interval() time.Duration {
+	if n := len(c.sharedOutputs()); c.outputMode == types.OutputModeStaggered && n > 1 {
+		return c.delay / time.Duration(n)
+	}
+	return c.delay
+}
+
+// syncOutputs records the outputs the renderer has and applies their scale
+// modes, and in the per-output modes gives outputs that have appeared since
+// the last call a wallpaper of their own, or the one they showed in the last
+// run. It must be called from the render thread.
+func (c *Manager) syncOutputs() {
+	if c.outputRenderer == nil {
+		return
+	}
+	outputs := c.outputRenderer.Outputs()
+
+	c.Lock()
+	var appeared, added []string
+	restored := make(map[string]string)
+	for _, name := range outputs {
+		if slices.Contains(c.outputs, name) {
+			continue
+		}
+		appeared = append(appeared, name)
+		if c.outputMode == types.OutputModeSame || c.outputWallpapers[name] != "" {
+			continue
+		}
+		if saved, ok := c.restoredOutputs[name]; ok {
+			delete(c.restoredOutputs, name)
+			c.outputWallpapers[name] = saved.Current
+			c.outputHistory[name] = saved.History
+			c.outputForward[name] = saved.Forward
+			restored[name] = saved.Current
+		} else {
+			added = append(added, name)
+		}
+	}
+	// outputs without a scale mode of their own keep the global one
+	modes := make(map[string]types.ScalingMode, len(appeared))
+	for _, name := range appeared {
+		if types.ScalingMode(c.outputConfig(name).ScaleMode) == types.ScalingModeSpan {
+			log.Warnf("The span scale_mode cannot be used for one output, ignoring it for %v", name)
+		}
+		if mode := c.outputScaleMode(name); mode != "" {
+			modes[name] = mode
+		}
+	}
+	c.outputs = outputs
+	maps.DeleteFunc(c.outputWallpapers, func(name, _ string) bool {
+		return !slices.Contains(outputs, name)
+	})
+	maps.DeleteFunc(c.outputChanged, func(name string, _ time.Time) bool {
+		return !slices.Contains(outputs, name)
+	})
+	maps.DeleteFunc(c.outputHistory, func(name string, _ []string) bool {
+		return !slices.Contains(outputs, name)
+	})
+	maps.DeleteFunc(c.outputForward, func(name string, _ []string) bool {
+		return !slices.Contains(outputs, name)
+	})
+	c.Unlock()
+
+	for name, mode := range modes {
+		c.outputRenderer.SetOutputScaleMode(name, mode)
+	}
+	added = append(added, c.showOutputs(restored)...)
+	if len(added) > 0 {
+		c.nextOutputs(added)
+	}
+}
+
+// emptyOutputs returns the outputs that have no wallpaper of their own.
+func (c *Manager) emptyOutputs() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	var empty []string
+	for _, name := range c.outputs {
+		if c.outputWallpapers[name] == "" {
+			empty = append(empty, name)
+		}
+	}
+	return empty
+}
+
+// changingOutputs returns the outputs that change next, for prefetching: in
+// the staggered mode the output whose turn it is and those with a delay of
+// their own, in the independent mode every output, and a single empty name
+// when every output shows the same wallpaper.
+func (c *Manager) changingOutputs() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	switch c.outputMode {
+	case types.OutputModeSame:
+		return []string{""}
+	case types.OutputModeStaggered:
+		shared := c.sharedOutputs()
+		var outputs []string
+		for _, name := range c.outputs {
+			if !slices.Contains(shared, name) {
+				outputs = append(outputs, name)
+			}
+		}
+		if len(shared) > 0 {
+			outputs = append([]string{shared[c.nextOutput%len(shared)]}, outputs...)
+		}
+		return outputs
+	}
+	return slices.Clone(c.outputs)
+}
+
+// advance changes the wallpaper when the slideshow timer expires. Outputs
+// with a delay of their own keep their wallpaper, and in the staggered mode
+// only the output whose turn it is changes.
+func (c *Manager) advance() {
+	c.Lock()
+	mode := c.outputMode
+	outputs := c.sharedOutputs()
+	if mode == types.OutputModeStaggered && len(outputs) > 0 {
+		c.nextOutput %= len(outputs)
+		outputs = outputs[c.nextOutput : c.nextOutput+1]
+		c.nextOutput++
+	}
+	c.Unlock()
+
+	switch {
+	case mode == types.OutputModeSame:
+		c.Next()
+	case len(outputs) > 0:
+		c.nextOutputs(outputs)
+	}
+}
+
+// nextOutputs gives each of the given outputs the next wallpaper in the
+// rotation it takes wallpapers from and fades them all at once. Wallpapers
+// that fail to load are quarantined and skipped.
+func (c *Manager) nextOutputs(outputs []string) {
+	images := make(map[string]image.Image, len(outputs))
+	files := make(map[string]string, len(outputs))
+	for _, name := range outputs {
+		target := c.outputTarget(name)
+		for range len(c.GetWallpapers()) + 1 {
+			nextFile := c.nextWallpaperFor(name)
+			if nextFile == "" {
+				break
+			}
+
+			img, err := c.prepare(nextFile, target)
+			if err != nil {
+				c.quarantine(nextFile, err)
+				continue
+			}
+			images[name] = img
+			files[name] = nextFile
+			break
+		}
+	}
+	if len(images) == 0 {
+		log.Warn("No wallpapers available, keeping the current ones")
+		return
+	}
+
+	c.Lock()
+	for name := range files {
+		c.pushOutputHistory(name, c.outputWallpapers[name])
+	}
+	c.Unlock()
+	c.transitionOutputs(images, files)
+}
+
+// previousOutputs steps every output back to the wallpaper it showed before
+// its current one. The wallpapers stepped over are replayed on the same
+// output before its rotation continues, as they are for the shared wallpaper.
+func (c *Manager) previousOutputs() {
+	c.Lock()
+	prev := make(map[string]string, len(c.outputs))
+	for _, name := range c.outputs {
+		history := c.outputHistory[name]
+		if n := len(history); n > 0 {
+			prev[name] = history[n-1]
+			c.outputHistory[name] = history[:n-1]
+		}
+	}
+	c.Unlock()
+	if len(prev) == 0 {
+		log.Info("No previous wallpaper in history")
+		return
+	}
+
+	images := make(map[string]image.Image, len(prev))
+	files := make(map[string]string, len(prev))
+	for name, file := range prev {
+		img, err := c.prepare(file, c.outputTarget(name))
+		if err != nil {
+			c.quarantine(file, err)
+			continue
+		}
+		images[name] = img
+		files[name] = file
+	}
+	if len(images) == 0 {
+		return
+	}
+
+	c.Lock()
+	for name := range files {
+		if current := c.outputWallpapers[name]; current != "" {
+			c.outputForward[name] = append(c.outputForward[name], current)
+		}
+	}
+	c.Unlock()
+	c.transitionOutputs(images, files)
+}
+
+// transitionOutputs fades each output to its image, recording the file as
+// the wallpaper the output shows.
+func (c *Manager) transitionOutputs(images map[string]image.Image, files map[string]string) {
+	c.Lock()
+	maps.Copy(c.outputWallpapers, files)
+	durations := make(map[string]time.Duration, len(files))
+	periods := make(map[string]time.Duration, len(files))
+	for name := range files {
+		durations[name] = c.fadeSpeed(name)
+		periods[name] = c.motionPeriod(name)
+		c.outputChangedNow(name)
+	}
+	c.Unlock()
+
+	for name, period := range periods {
+		c.outputRenderer.SetOutputMotionPeriod(name, period)
+	}
+
+	err := c.outputRenderer.TransitionOutputs(images, durations)
+	if err != nil {
+		log.Errorf("Failed to transition images: %v", err)
+	}
+}
+
+// showOutputs shows each output its wallpaper without a fade, skipping
+// outputs the renderer no longer has. Outputs whose wallpaper fails to load
+// are left without one, and returned.
+func (c *Manager) showOutputs(files map[string]string) []string {
+	var failed []string
+	outputs := c.outputRenderer.Outputs()
+	for name, file := range files {
+		if !slices.Contains(outputs, name) {
+			// the output went away while the display was disconnected
+			continue
+		}
+		img, err := loadImage(file)
+		if err != nil {
+			log.Error("Failed to load current image:", err)
+			c.quarantine(file, err)
+			c.Lock()
+			delete(c.outputWallpapers, name)
+			c.Unlock()
+			failed = append(failed, name)
+			continue
+		}
+		c.Lock()
+		period := c.motionPeriod(name)
+		c.Unlock()
+		c.outputRenderer.SetOutputMotionPeriod(name, period)
+		if err := c.outputRenderer.SetOutputImage(name, resample.Fit(img, c.outputTarget(name))); err != nil {
+			log.Errorf("Failed to set current image on %v: %v", name, err)
+		}
+	}
+	return failed
+}
+
+// setCurrentOutputs shows each output's wallpaper again without a fade, for
+// when the display has been reconnected.
+func (c *Manager) setCurrentOutputs() {
+	c.Lock()
+	current := maps.Clone(c.outputWallpapers)
+	c.Unlock()
+	c.showOutputs(current)
+
+	// outputs that have no wallpaper yet are given one
+	c.syncOutputs()
+	if empty := c.emptyOutputs(); len(empty) > 0 {
+		c.nextOutputs(empty)
+	}
+}
@@ -0,0 +1,202 @@
+package ipc
+
+import (
+	"image"
+	"image/draw"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/resample"
+)
+
+// prefetcher decodes upcoming wallpapers on a worker goroutine so that a
+// transition can start as soon as the timer fires, instead of stalling the
+// render loop while a large image is read and decoded. Decoded images are
+// held as RGBA so the renderers can upload them without another conversion.
+type prefetcher struct {
+	sync.Mutex
+	wanted   []prefetchItem               // upcoming wallpapers, in the order they will be shown
+	ready    map[prefetchItem]*image.RGBA // decoded wallpapers waiting to be used
+	skipped  map[prefetchItem]bool        // wallpapers that failed to decode or did not fit the memory cap
+	size     int64                        // bytes held in ready
+	maxBytes int64                        // memory cap for ready
+	wake     chan struct{}
+}
+
+// prefetchItem is a wallpaper to decode and the output it is scaled down for.
+type prefetchItem struct {
+	path   string
+	target resample.Target
+}
+
+func newPrefetcher(maxBytes int64) *prefetcher {
+	p := &prefetcher{
+		ready:    make(map[prefetchItem]*image.RGBA),
+		skipped:  make(map[prefetchItem]bool),
+		maxBytes: maxBytes,
+		wake:     make(chan struct{}, 1),
+	}
+	go p.run()
+	return p
+}
+
+// Want sets the wallpapers that will be shown next, each with the output it
+// is scaled for. Decoded images that are no longer wanted are dropped, and
+// missing ones are queued for decoding.
+func (p *prefetcher) Want(items []prefetchItem) {
+	p.Lock()
+	defer p.Unlock()
+
+	if slices.Equal(p.wanted, items) {
+		return
+	}
+	p.wanted = slices.Clone(items)
+
+	for item, img := range p.ready {
+		if !slices.Contains(p.wanted, item) {
+			p.size -= int64(len(img.Pix))
+			delete(p.ready, item)
+		}
+	}
+	for item := range p.skipped {
+		if !slices.Contains(p.wanted, item) {
+			delete(p.skipped, item)
+		}
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Take returns the decoded image for path if it has been prefetched for the
+// target, handing ownership to the caller.
+func (p *prefetcher) Take(path string, target resample.Target) (*image.RGBA, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	item := prefetchItem{path, target}
+	img, ok := p.ready[item]
+	if ok {
+		p.size -= int64(len(img.Pix))
+		delete(p.ready, item)
+	}
+	return img, ok
+}
+
+func (p *prefetcher) run() {
+	for range p.wake {
+		for {
+			item, ok := p.next()
+			if !ok {
+				break
+			}
+			p.decode(item)
+		}
+	}
+}
+
+// next returns the first wanted wallpaper that still needs decoding.
+func (p *prefetcher) next() (prefetchItem, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, item := range p.wanted {
+		if _, ok := p.ready[item]; ok || p.skipped[item] {
+			continue
+		}
+		return item, true
+	}
+	return prefetchItem{}, false
+}
+
+func (p *prefetcher) decode(item prefetchItem) {
+	path, target := item.path, item.target
+	size, err := decodedSize(path, target)
+	if err == nil && !p.fits(size) {
+		log.Debugf("Not prefetching %v, it would exceed the prefetch memory limit", path)
+		p.skip(item)
+		return
+	}
+
+	img, err := loadImage(path)
+	if err != nil {
+		// leave it for the render loop, which quarantines it
+		log.Debugf("Prefetch of %v failed: %v", path, err)
+		p.skip(item)
+		return
+	}
+	if _, ok := img.(*imageformat.Animation); ok {
+		// every frame would count against the memory limit
+		log.Debugf("Not prefetching %v, it is animated", path)
+		p.skip(item)
+		return
+	}
+	rgba := toRGBA(resample.Fit(img, target))
+
+	p.Lock()
+	defer p.Unlock()
+	if !slices.Contains(p.wanted, item) || p.size+int64(len(rgba.Pix)) > p.maxBytes {
+		return
+	}
+	p.ready[item] = rgba
+	p.size += int64(len(rgba.Pix))
+	log.Debugf("Prefetched %v (%vx%v)", path, rgba.Bounds().Dx(), rgba.Bounds().Dy())
+}
+
+func (p *prefetcher) fits(size int64) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.size+size <= p.maxBytes
+}
+
+func (p *prefetcher) skip(item prefetchItem) {
+	p.Lock()
+	defer p.Unlock()
+	if slices.Contains(p.wanted, item) {
+		p.skipped[item] = true
+	}
+}
+
+// decodedSize returns the number of bytes the image at path takes as RGBA
+// once scaled for the target, reading only its header.
+func decodedSize(path string, target resample.Target) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, err
+	}
+	w, h := cfg.Width, cfg.Height
+
+	// photos turned on their side are stored with the dimensions swapped;
+	// the EXIF data sits near the start of the file
+	head := make([]byte, 64<<10)
+	n, _ := f.ReadAt(head, 0)
+	if imageformat.Orientation(head[:n]) >= imageformat.OrientationTranspose {
+		w, h = h, w
+	}
+
+	w, h = target.Size(w, h)
+	return int64(w) * int64(h) * 4, nil
+}
+
+// toRGBA converts an image to RGBA with its origin at zero, the layout the
+// renderers upload directly.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,78 @@
+package ipc
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// quarantine records that a wallpaper failed to load so that it is skipped
+// until the retry interval has passed.
+func (c *Manager) quarantine(path string, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	f, ok := c.failed[path]
+	if !ok {
+		f = &FailedWallpaper{Path: path}
+		c.failed[path] = f
+	}
+	f.Reason = err.Error()
+	f.FailedAt = time.Now()
+	f.Attempts++
+	if c.retryInterval > 0 {
+		f.RetryAt = f.FailedAt.Add(c.retryInterval)
+	}
+
+	log.Warnf("Skipping wallpaper that failed to load: %v", err)
+}
+
+// clearFailure forgets a previous failure once the wallpaper loads again.
+func (c *Manager) clearFailure(path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.failed[path]; ok {
+		log.Infof("Wallpaper %v loads again, returning it to the rotation", path)
+		delete(c.failed, path)
+	}
+}
+
+// isQuarantined reports whether a wallpaper should currently be skipped. The
+// caller must hold the lock.
+func (c *Manager) isQuarantined(path string) bool {
+	f, ok := c.failed[path]
+	if !ok {
+		return false
+	}
+	return f.RetryAt.IsZero() || time.Now().Before(f.RetryAt)
+}
+
+// restoreCurrent makes prev the current wallpaper again after the wallpaper
+// that was about to replace it failed to load, taking prev back off pushed,
+// the stack it was pushed onto: c.history when stepping on, or c.forward when
+// stepping back.
+func (c *Manager) restoreCurrent(prev string, pushed *[]string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.currentWallpaper = prev
+	// nothing was pushed for an empty wallpaper or a time-lapse frame
+	if n := len(*pushed); prev != "" && n > 0 && (*pushed)[n-1] == prev {
+		*pushed = (*pushed)[:n-1]
+	}
+}
+
+// FailedWallpapers returns the wallpapers that failed to load, sorted by path.
+func (c *Manager) FailedWallpapers() []FailedWallpaper {
+	c.Lock()
+	defer c.Unlock()
+
+	failed := make([]FailedWallpaper, 0, len(c.failed))
+	for _, path := range slices.Sorted(maps.Keys(c.failed)) {
+		failed = append(failed, *c.failed[path])
+	}
+	return failed
+}
@@ -6,7 +6,14 @@ import (
 
 func RegisterRoutes(e *echo.Echo, manager ManagerInterface) {
 	e.GET("/status", statusHandler(manager))
+	e.GET("/errors", errorsHandler(manager))
+	e.GET("/schedule", scheduleHandler(manager))
 	e.POST("/stop", stopHandler(manager))
 	e.POST("/next", nextHandler(manager))
+	e.POST("/previous", previousHandler(manager))
 	e.POST("/load", loadHandler(manager))
+	e.POST("/set", setHandler(manager))
+	e.POST("/pause", pauseHandler(manager))
+	e.POST("/resume", resumeHandler(manager))
+	e.POST("/toggle", toggleHandler(manager))
 }
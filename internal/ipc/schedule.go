@@ -0,0 +1,107 @@
+package ipc
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/solar"
+)
+
+// applySchedule switches to the schedule rule in effect now, using its delay,
+// and reports whether the wallpaper should change because a different rule
+// came into effect. A rule that comes into effect while the slideshow is
+// paused changes the wallpaper once it is resumed. A time-lapse shows its
+// frame through dueFrame instead.
+func (c *Manager) applySchedule() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if rule, changed := c.schedule.Update(); changed {
+		c.activeRule = rule
+		c.shownFrame = ""
+		c.delay = globalDelay()
+		if rule == nil {
+			log.Info("No schedule is in effect, using the global wallpapers and settings")
+		} else {
+			if rule.Delay > 0 {
+				c.delay = time.Duration(rule.Delay) * time.Second
+			}
+			log.Infof("Schedule %q is now in effect", rule.Name)
+		}
+		c.scheduleSwitch = !c.timelapseActive()
+	}
+
+	if !c.scheduleSwitch || c.paused {
+		return false
+	}
+	c.scheduleSwitch = false
+	return true
+}
+
+// timelapseActive reports whether the schedule rule in effect is a time-lapse,
+// which follows the sun instead of the timer. The caller must hold the lock.
+func (c *Manager) timelapseActive() bool {
+	return c.activeRule != nil && len(c.activeRule.Frames) > 0
+}
+
+// dueFrame returns the frame of the time-lapse in effect that matches the
+// sun's position now, if it is not the one shown last. It returns "" if no
+// time-lapse is in effect or the slideshow is paused.
+func (c *Manager) dueFrame() string {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.paused {
+		return ""
+	}
+	frame := c.schedule.Frame(c.activeRule)
+	if frame == "" || frame == c.shownFrame {
+		return ""
+	}
+	c.shownFrame = frame
+	return frame
+}
+
+// scheduleDirs returns the wallpaper directories of every schedule rule.
+func (c *Manager) scheduleDirs() []string {
+	var dirs []string
+	for _, rule := range c.schedule.Rules() {
+		dirs = append(dirs, rule.Wallpapers...)
+	}
+	return dirs
+}
+
+// Schedule returns the schedule rule in effect and when it next changes.
+func (c *Manager) Schedule() ScheduleResponse {
+	c.Lock()
+	rule := c.activeRule
+	resp := ScheduleResponse{
+		Rules:     len(c.schedule.Rules()),
+		Delay:     int(c.delay.Seconds()),
+		FadeSpeed: int(c.fadeSpeed("").Seconds()),
+	}
+	c.Unlock()
+
+	if rule != nil {
+		resp.Active = rule.Name
+		resp.Wallpapers = rule.Wallpapers
+		resp.Frame = c.schedule.Frame(rule)
+	}
+	if loc := c.schedule.Location(); loc != nil {
+		now := c.schedule.Now()
+		y, m, d := now.Date()
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		rise, set := solar.Times(now, *loc, solar.Sunrise)
+		if rise < 24*time.Hour && set > 0 {
+			resp.Sunrise = midnight.Add(rise)
+			resp.Sunset = midnight.Add(set)
+		}
+	}
+	if at, next, ok := c.schedule.Next(); ok {
+		resp.NextChange = at
+		if next != nil {
+			resp.Next = next.Name
+		}
+	}
+	return resp
+}
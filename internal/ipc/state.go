@@ -0,0 +1,178 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/selection"
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+// stateVersion is the version of the saved state's format, raised when it
+// changes in a way that older versions cannot read.
+const stateVersion = 1
+
+// savedState is the part of the manager's state that is kept across
+// restarts, so that the rotation carries on where it left off instead of
+// starting again with a new shuffle.
+type savedState struct {
+	Version    int                    `json:"version"`
+	Wallpapers []string               `json:"wallpapers"`        // the rotation, the next wallpaper first
+	Current    string                 `json:"current"`           // the wallpaper shown
+	History    []string               `json:"history"`           // recently shown wallpapers, most recent last
+	Forward    []string               `json:"forward,omitempty"` // wallpapers stepped back over
+	Outputs    map[string]savedOutput `json:"outputs,omitempty"` // the wallpaper of each output in the per-output modes, by name
+	Selection  selection.State        `json:"selection"`         // what the selection strategy needs to carry on
+}
+
+// savedOutput is the saved state of one output in the per-output modes.
+type savedOutput struct {
+	Current string   `json:"current"`
+	History []string `json:"history,omitempty"` // wallpapers previously shown on the output, most recent last
+	Forward []string `json:"forward,omitempty"` // wallpapers the output stepped back over
+}
+
+// statePath returns where the state is saved, in $XDG_STATE_HOME or
+// ~/.local/state if that is not set.
+func statePath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "smoothpaper", "state.json")
+}
+
+// RestoreState restores the rotation, the current wallpapers, the history and
+// the selection strategy's state saved by the last run. Wallpapers that have
+// been deleted since are dropped, and new ones are added as AddWallpapers
+// would. Outputs get their wallpaper back once the renderer finds them. It
+// returns false, leaving the manager alone, if there is no saved state to
+// restore.
+func (c *Manager) RestoreState() bool {
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Failed to read the saved state: %v", err)
+		}
+		return false
+	}
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Warnf("Ignoring the saved state in %v: %v", statePath(), err)
+		return false
+	}
+	if state.Version > stateVersion {
+		log.Warnf("Ignoring the saved state in %v, which a newer version saved", statePath())
+		return false
+	}
+
+	c.Lock()
+	found := make(map[string]bool, len(c.wallpapers))
+	for _, w := range c.wallpapers {
+		found[w] = true
+	}
+	gone := func(w string) bool { return !found[w] }
+
+	saved := make(map[string]bool, len(state.Wallpapers))
+	for _, w := range state.Wallpapers {
+		saved[w] = true
+	}
+	added := slices.DeleteFunc(slices.Clone(c.wallpapers), func(w string) bool {
+		return saved[w]
+	})
+	c.wallpapers = slices.DeleteFunc(state.Wallpapers, gone)
+	c.history = slices.DeleteFunc(state.History, gone)
+	c.forward = slices.DeleteFunc(state.Forward, gone)
+	if found[state.Current] {
+		c.currentWallpaper = state.Current
+	}
+	if c.outputMode != types.OutputModeSame {
+		c.restoredOutputs = make(map[string]savedOutput, len(state.Outputs))
+		for name, output := range state.Outputs {
+			if found[output.Current] {
+				output.History = slices.DeleteFunc(output.History, gone)
+				output.Forward = slices.DeleteFunc(output.Forward, gone)
+				c.restoredOutputs[name] = output
+			}
+		}
+	}
+	c.strategy.Restore(state.Selection)
+	c.Unlock()
+
+	n := c.AddWallpapers(added)
+	log.Infof("Restored the saved rotation, with %d new wallpapers", n)
+	return true
+}
+
+// saveState writes the state to disk if it has changed since it was last
+// saved. The file is replaced atomically, so a crash never leaves it half
+// written.
+func (c *Manager) saveState() {
+	c.stateDirty = false
+	c.stateSavedAt = time.Now()
+
+	c.Lock()
+	// outputs that have not been found since the restart keep what they
+	// showed, in case they come back
+	outputs := maps.Clone(c.restoredOutputs)
+	if outputs == nil {
+		outputs = make(map[string]savedOutput, len(c.outputWallpapers))
+	}
+	for name, w := range c.outputWallpapers {
+		outputs[name] = savedOutput{Current: w, History: c.outputHistory[name], Forward: c.outputForward[name]}
+	}
+	data, err := json.MarshalIndent(savedState{
+		Version:    stateVersion,
+		Wallpapers: c.wallpapers,
+		Current:    c.currentWallpaper,
+		History:    c.history,
+		Forward:    c.forward,
+		Outputs:    outputs,
+		Selection:  c.strategy.State(c.wallpapers),
+	}, "", "  ")
+	c.Unlock()
+	if err != nil || bytes.Equal(data, c.savedState) {
+		return
+	}
+
+	if err := writeFileAtomic(statePath(), data); err != nil {
+		log.Warnf("Failed to save the state: %v", err)
+		return
+	}
+	c.savedState = data
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path once it is safely on disk.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -1,25 +1,75 @@
 package ipc
 
+import "time"
+
 type CommandType string
 
 const (
-	CommandStop   CommandType = "stop"   // stop the wallpaper manager
-	CommandNext   CommandType = "next"   // next wallpaper
-	CommandLoad   CommandType = "load"   // replace the list of wallpapers
-	CommandStatus CommandType = "status" // gets the current status
-	CommandAdd    CommandType = "add"
+	CommandStop        CommandType = "stop"     // stop the wallpaper manager
+	CommandNext        CommandType = "next"     // next wallpaper
+	CommandPrevious    CommandType = "previous" // previous wallpaper from the history
+	CommandSet         CommandType = "set"      // show a specific wallpaper without changing the list
+	CommandLoad        CommandType = "load"     // replace the list of wallpapers
+	CommandPause       CommandType = "pause"    // pause the slideshow timer
+	CommandResume      CommandType = "resume"   // resume the slideshow timer
+	CommandTogglePause CommandType = "toggle"   // pause or resume the slideshow timer
+	CommandStatus      CommandType = "status"   // gets the current status
+	CommandAdd         CommandType = "add"      // add wallpapers to the list
+	CommandRemove      CommandType = "remove"   // remove wallpapers, or directories of them, from the list
 )
 
 type Command struct {
-	Type CommandType `json:"type"`
-	Args []string    `json:"args"`
+	Type CommandType  `json:"type"`
+	Args []string     `json:"args"`
+	Done chan<- error `json:"-"` // receives the outcome once the command has run, if not nil; it must have room for it
+}
+
+// reply sends the outcome of the command to whoever is waiting for it.
+func (cmd Command) reply(err error) {
+	if cmd.Done != nil {
+		cmd.Done <- err
+	}
 }
 
 type ManagerInterface interface {
 	CurrentWallpaper() string
+	Paused() bool
+	TimeRemaining() time.Duration
+	FailedWallpapers() []FailedWallpaper
+	OutputWallpapers() map[string]string
+	Schedule() ScheduleResponse
 	EnqueueCommand(Command)
 }
 
+type SetRequest struct {
+	Wallpaper string `json:"wallpaper"`
+}
+
+// FailedWallpaper describes a wallpaper that could not be loaded and is
+// skipped until RetryAt. A zero RetryAt means it is not retried.
+type FailedWallpaper struct {
+	Path     string    `json:"path"`
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+	RetryAt  time.Time `json:"retry_at,omitzero"`
+	Attempts int       `json:"attempts"`
+}
+
+// ScheduleResponse describes the schedule rule in effect and when the next
+// rule takes over. An empty rule name means the global settings apply.
+type ScheduleResponse struct {
+	Rules      int       `json:"rules"`                // number of schedule rules configured
+	Active     string    `json:"active"`               // name of the rule in effect
+	Wallpapers []string  `json:"wallpapers,omitempty"` // directories the rule in effect shows
+	Frame      string    `json:"frame,omitempty"`      // time-lapse frame the sun's position calls for
+	Delay      int       `json:"delay"`                // seconds between wallpaper changes
+	FadeSpeed  int       `json:"fade_speed"`           // seconds a transition takes
+	NextChange time.Time `json:"next_change,omitzero"` // when the next rule takes over; zero if none does within a month
+	Next       string    `json:"next"`                 // name of the rule in effect after the next change
+	Sunrise    time.Time `json:"sunrise,omitzero"`     // today's sunrise, if latitude and longitude are set and the sun rises
+	Sunset     time.Time `json:"sunset,omitzero"`      // today's sunset
+}
+
 type Response struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
@@ -27,11 +77,15 @@ type Response struct {
 }
 
 type StatusResponse struct {
-	Status           string `json:"status"`
-	Message          string `json:"message"`
-	Version          string `json:"version"`
-	PID              int    `json:"pid"`
-	Socket           string `json:"socket"`
-	Config           string `json:"config"`
-	CurrentWallpaper string `json:"current_wallpaper"`
+	Status           string            `json:"status"`
+	Message          string            `json:"message"`
+	Version          string            `json:"version"`
+	PID              int               `json:"pid"`
+	Socket           string            `json:"socket"`
+	Config           string            `json:"config"`
+	CurrentWallpaper string            `json:"current_wallpaper"`
+	Paused           bool              `json:"paused"`
+	SecondsRemaining int               `json:"seconds_remaining"` // seconds until the next wallpaper change
+	FailedWallpapers []FailedWallpaper `json:"failed_wallpapers"`
+	Outputs          map[string]string `json:"outputs,omitempty"` // wallpaper shown on each output, by output name
 }
@@ -0,0 +1,89 @@
+// Package kenburns describes the slow pan and zoom across a wallpaper while
+// it is shown, as a crop of the texture coordinates the renderers draw it
+// with.
+package kenburns
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Config holds the Ken Burns settings.
+type Config struct {
+	Enabled bool          // whether wallpapers pan and zoom at all
+	MaxZoom float32       // how far in the motion zooms, such as 1.2 for 20%
+	Random  bool          // whether each wallpaper moves in a random direction, rather than zooming into the center
+	Period  time.Duration // how long a motion lasts; a wallpaper is shown for its delay and then fades out
+}
+
+// View is the part of an image that is shown. Zoom is how far in it is, and
+// X and Y place the shown part within the image, from 0 at one edge to 1 at
+// the other, so the view never leaves the image.
+type View struct {
+	Zoom float32
+	X, Y float32
+}
+
+// Full shows the whole image.
+var Full = View{Zoom: 1, X: 0.5, Y: 0.5}
+
+// Crop returns the part of the texture coordinates u1, v1 to u2, v2 that the
+// view shows.
+func (v View) Crop(u1, v1, u2, v2 float32) (float32, float32, float32, float32) {
+	if v.Zoom <= 1 {
+		return u1, v1, u2, v2
+	}
+	du, dv := u2-u1, v2-v1
+	w, h := du/v.Zoom, dv/v.Zoom
+	nu1 := u1 + (du-w)*v.X
+	nv1 := v1 + (dv-h)*v.Y
+	return nu1, nv1, nu1 + w, nv1 + h
+}
+
+// Motion is a pan and zoom across one wallpaper, starting when it starts
+// fading in.
+type Motion struct {
+	From, To View
+	Start    time.Time
+	Period   time.Duration
+}
+
+// Start returns a new motion for a wallpaper that is about to be shown, or a
+// motion that always shows the whole image if Ken Burns is disabled.
+func (c Config) Start() Motion {
+	m := Motion{From: Full, To: Full, Start: time.Now(), Period: c.Period}
+	if !c.Enabled || c.MaxZoom <= 1 {
+		return m
+	}
+
+	if !c.Random {
+		m.To.Zoom = c.MaxZoom
+		return m
+	}
+
+	from := View{Zoom: c.MaxZoom, X: rand.Float32(), Y: rand.Float32()}
+	to := View{Zoom: c.MaxZoom, X: rand.Float32(), Y: rand.Float32()}
+	switch rand.IntN(3) {
+	case 0: // zoom in
+		from.Zoom = 1
+	case 1: // zoom out
+		to.Zoom = 1
+	default: // pan across at the full zoom
+	}
+	m.From, m.To = from, to
+	return m
+}
+
+// View returns the part of the wallpaper shown now. The motion holds still
+// once its period is over.
+func (m Motion) View() View {
+	if m.Period <= 0 || m.From == m.To {
+		return m.To
+	}
+	t := min(float32(time.Since(m.Start).Seconds()/m.Period.Seconds()), 1)
+	return View{
+		Zoom: m.From.Zoom + (m.To.Zoom-m.From.Zoom)*t,
+		X:    m.From.X + (m.To.X-m.From.X)*t,
+		Y:    m.From.Y + (m.To.Y-m.From.Y)*t,
+	}
+}
@@ -0,0 +1,100 @@
+// Package quad works out where the renderers draw a wallpaper on an output
+// for each scale mode, so that both renderers place images the same way.
+package quad
+
+import "github.com/matjam/smoothpaper/internal/types"
+
+// Quad is a rectangle drawn on an output and the part of the texture drawn on
+// it. X and Y are in clip space, from -1 at the bottom left of the output to 1
+// at the top right. U and V are texture coordinates; V1 is at Y1, the bottom,
+// and textures are uploaded top row first, so V1 is usually the larger.
+type Quad struct {
+	X1, Y1, X2, Y2 float32
+	U1, V1, U2, V2 float32
+}
+
+// full covers the whole output with the whole texture.
+var full = Quad{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0}
+
+// Layout returns the quads that draw a texture of texWidth x texHeight pixels
+// on an output of screenWidth x screenHeight pixels with the scale mode. Every
+// mode but tile draws a single quad. Span is laid out as fill, since it covers
+// an output made of every monitor; fit-blur is laid out as fit, and the
+// renderer draws the blurred copy behind it with fill.
+func Layout(mode types.ScalingMode, screenWidth, screenHeight, texWidth, texHeight int) []Quad {
+	if screenWidth <= 0 || screenHeight <= 0 || texWidth <= 0 || texHeight <= 0 {
+		return nil
+	}
+
+	q := full
+	screenAspect := float32(screenWidth) / float32(screenHeight)
+	textureAspect := float32(texWidth) / float32(texHeight)
+
+	switch mode {
+	case types.ScalingModeStretch:
+		// the whole texture over the whole output
+
+	case types.ScalingModeFill, types.ScalingModeSpan:
+		// cover the output, cropping the texture evenly on the sides that do
+		// not fit
+		if textureAspect > screenAspect {
+			crop := (1 - screenAspect/textureAspect) / 2
+			q.U1, q.U2 = crop, 1-crop
+		} else {
+			crop := (1 - textureAspect/screenAspect) / 2
+			q.V1, q.V2 = 1-crop, crop
+		}
+
+	case types.ScalingModeFitHorizontal:
+		// keep the width, and the height follows the texture's aspect ratio
+		h := screenAspect / textureAspect
+		q.Y1, q.Y2 = -h, h
+
+	case types.ScalingModeFitVertical:
+		// keep the height, and the width follows the texture's aspect ratio
+		w := textureAspect / screenAspect
+		q.X1, q.X2 = -w, w
+
+	case types.ScalingModeTile:
+		return tile(screenWidth, screenHeight, texWidth, texHeight)
+
+	case types.ScalingModeCenter, types.ScalingModeFit, types.ScalingModeFitBlur:
+		fallthrough
+	default:
+		// as large as fits without cropping, centered, leaving bars on two sides
+		if textureAspect > screenAspect {
+			h := screenAspect / textureAspect
+			q.Y1, q.Y2 = -h, h
+		} else {
+			w := textureAspect / screenAspect
+			q.X1, q.X2 = -w, w
+		}
+	}
+
+	return []Quad{q}
+}
+
+// tile repeats the texture at its own size from the top left of the output,
+// cutting off the tiles along the right and bottom edges. Textures are not
+// repeated by wrapping, which OpenGL ES does not allow for every size.
+func tile(screenWidth, screenHeight, texWidth, texHeight int) []Quad {
+	tw := 2 * float32(texWidth) / float32(screenWidth)
+	th := 2 * float32(texHeight) / float32(screenHeight)
+	cols := (screenWidth + texWidth - 1) / texWidth
+	rows := (screenHeight + texHeight - 1) / texHeight
+
+	quads := make([]Quad, 0, cols*rows)
+	for row := range rows {
+		y2 := 1 - float32(row)*th
+		y1 := max(y2-th, -1)
+		for col := range cols {
+			x1 := -1 + float32(col)*tw
+			x2 := min(x1+tw, 1)
+			quads = append(quads, Quad{
+				X1: x1, Y1: y1, X2: x2, Y2: y2,
+				U1: 0, V1: (y2 - y1) / th, U2: (x2 - x1) / tw, V2: 0,
+			})
+		}
+	}
+	return quads
+}
@@ -0,0 +1,102 @@
+package quad
+
+import (
+	"math"
+	"testing"
+
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+func TestLayout(t *testing.T) {
+	// the output is 200x100; the textures are wider, taller and the same
+	// shape
+	const screenW, screenH = 200, 100
+	wider := [2]int{400, 100}
+	taller := [2]int{100, 100}
+	equal := [2]int{400, 200}
+
+	fitWider := Quad{X1: -1, Y1: -0.5, X2: 1, Y2: 0.5, U1: 0, V1: 1, U2: 1, V2: 0}
+	fitTaller := Quad{X1: -0.5, Y1: -1, X2: 0.5, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0}
+
+	tests := []struct {
+		name string
+		mode types.ScalingMode
+		tex  [2]int
+		want []Quad
+	}{
+		{"stretch wider", types.ScalingModeStretch, wider, []Quad{full}},
+		{"stretch taller", types.ScalingModeStretch, taller, []Quad{full}},
+		{"stretch equal", types.ScalingModeStretch, equal, []Quad{full}},
+
+		{"fill wider", types.ScalingModeFill, wider, []Quad{{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0.25, V1: 1, U2: 0.75, V2: 0}}},
+		{"fill taller", types.ScalingModeFill, taller, []Quad{{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0, V1: 0.75, U2: 1, V2: 0.25}}},
+		{"fill equal", types.ScalingModeFill, equal, []Quad{full}},
+		{"span is laid out as fill", types.ScalingModeSpan, wider, []Quad{{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0.25, V1: 1, U2: 0.75, V2: 0}}},
+
+		{"fit wider", types.ScalingModeFit, wider, []Quad{fitWider}},
+		{"fit taller", types.ScalingModeFit, taller, []Quad{fitTaller}},
+		{"fit equal", types.ScalingModeFit, equal, []Quad{full}},
+
+		{"fit-blur wider", types.ScalingModeFitBlur, wider, []Quad{fitWider}},
+		{"fit-blur taller", types.ScalingModeFitBlur, taller, []Quad{fitTaller}},
+		{"fit-blur equal", types.ScalingModeFitBlur, equal, []Quad{full}},
+
+		{"center wider", types.ScalingModeCenter, wider, []Quad{fitWider}},
+		{"center taller", types.ScalingModeCenter, taller, []Quad{fitTaller}},
+		{"center equal", types.ScalingModeCenter, equal, []Quad{full}},
+
+		{"tile wider", types.ScalingModeTile, wider, []Quad{
+			{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0, V1: 1, U2: 0.5, V2: 0},
+		}},
+		{"tile taller", types.ScalingModeTile, taller, []Quad{
+			{X1: -1, Y1: -1, X2: 0, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0},
+			{X1: 0, Y1: -1, X2: 1, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0},
+		}},
+		{"tile equal", types.ScalingModeTile, equal, []Quad{
+			{X1: -1, Y1: -1, X2: 1, Y2: 1, U1: 0, V1: 0.5, U2: 0.5, V2: 0},
+		}},
+		{"tile cut off", types.ScalingModeTile, [2]int{80, 60}, []Quad{
+			{X1: -1, Y1: -0.2, X2: -0.2, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0},
+			{X1: -0.2, Y1: -0.2, X2: 0.6, Y2: 1, U1: 0, V1: 1, U2: 1, V2: 0},
+			{X1: 0.6, Y1: -0.2, X2: 1, Y2: 1, U1: 0, V1: 1, U2: 0.5, V2: 0},
+			{X1: -1, Y1: -1, X2: -0.2, Y2: -0.2, U1: 0, V1: 0.8 / 1.2, U2: 1, V2: 0},
+			{X1: -0.2, Y1: -1, X2: 0.6, Y2: -0.2, U1: 0, V1: 0.8 / 1.2, U2: 1, V2: 0},
+			{X1: 0.6, Y1: -1, X2: 1, Y2: -0.2, U1: 0, V1: 0.8 / 1.2, U2: 0.5, V2: 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Layout(tt.mode, screenW, screenH, tt.tex[0], tt.tex[1])
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d quads, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !near(got[i], tt.want[i]) {
+					t.Errorf("quad %d is %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLayoutEmpty(t *testing.T) {
+	if quads := Layout(types.ScalingModeFill, 0, 100, 10, 10); quads != nil {
+		t.Errorf("an output with no width got %+v", quads)
+	}
+	if quads := Layout(types.ScalingModeFill, 100, 100, 10, 0); quads != nil {
+		t.Errorf("a texture with no height got %+v", quads)
+	}
+}
+
+// near reports whether two quads are the same, allowing for rounding.
+func near(a, b Quad) bool {
+	as := []float32{a.X1, a.Y1, a.X2, a.Y2, a.U1, a.V1, a.U2, a.V2}
+	bs := []float32{b.X1, b.Y1, b.X2, b.Y2, b.U1, b.V1, b.U2, b.V2}
+	for i := range as {
+		if math.Abs(float64(as[i]-bs[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
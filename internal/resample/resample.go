@@ -0,0 +1,158 @@
+// Package resample scales wallpapers down to the size they are displayed at
+// before they are uploaded to the GPU.
+package resample
+
+import (
+	"image"
+	"math"
+	"slices"
+
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/types"
+	"golang.org/x/image/draw"
+)
+
+// Target describes the largest output an image will be displayed on, or the
+// combined layout of all outputs when the image is spanned across them.
+type Target struct {
+	Width          int               // width of the largest output in pixels
+	Height         int               // height of the largest output in pixels
+	ScaleMode      types.ScalingMode // how the image is scaled onto the output
+	MaxTextureSize int               // GL_MAX_TEXTURE_SIZE, or 0 if unknown
+}
+
+// Size returns the dimensions an image of width w and height h should be
+// scaled to for the target. Images are never scaled up.
+func (t Target) Size(w, h int) (int, int) {
+	if w <= 0 || h <= 0 {
+		return w, h
+	}
+
+	nw, nh := w, h
+	if t.Width > 0 && t.Height > 0 {
+		sx := float64(t.Width) / float64(w)
+		sy := float64(t.Height) / float64(h)
+
+		switch t.ScaleMode {
+		case types.ScalingModeStretch:
+			// the aspect ratio is not preserved anyway, so each axis only needs
+			// as many pixels as the output has
+			nw, nh = min(w, t.Width), min(h, t.Height)
+		case types.ScalingModeFitHorizontal:
+			nw, nh = scaled(w, h, sx)
+		case types.ScalingModeFitVertical:
+			nw, nh = scaled(w, h, sy)
+		case types.ScalingModeSpan, types.ScalingModeFill:
+			// the image covers the whole layout or output, which the target
+			// describes
+			nw, nh = scaled(w, h, max(sx, sy))
+		case types.ScalingModeTile:
+			// tiles are drawn at the image's own size
+		case types.ScalingModeCenter:
+			fallthrough
+		default:
+			nw, nh = scaled(w, h, min(sx, sy))
+		}
+	}
+
+	return Limit(nw, nh, t.MaxTextureSize)
+}
+
+// Limit returns w and h scaled down proportionally so that neither exceeds
+// maxSize. A maxSize of 0 means there is no limit.
+func Limit(w, h, maxSize int) (int, int) {
+	if maxSize <= 0 || (w <= maxSize && h <= maxSize) {
+		return w, h
+	}
+	if w >= h {
+		return maxSize, max(1, h*maxSize/w)
+	}
+	return max(1, w*maxSize/h), maxSize
+}
+
+// Fit returns img scaled down for the target, or img itself if it is already
+// small enough. Every frame of an animation is scaled.
+func Fit(img image.Image, t Target) image.Image {
+	b := img.Bounds()
+	w, h := t.Size(b.Dx(), b.Dy())
+	if anim, ok := img.(*imageformat.Animation); ok {
+		return ScaleAnimation(anim, w, h)
+	}
+	return Scale(img, w, h)
+}
+
+// ScaleAnimation returns every frame of anim resampled to w x h, or anim
+// itself if it already has that size.
+func ScaleAnimation(anim *imageformat.Animation, w, h int) *imageformat.Animation {
+	b := anim.Bounds()
+	if w == b.Dx() && h == b.Dy() {
+		return anim
+	}
+	scaled := &imageformat.Animation{Delays: anim.Delays}
+	for _, frame := range anim.Frames {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), frame, frame.Bounds(), draw.Src, nil)
+		scaled.Frames = append(scaled.Frames, dst)
+	}
+	return scaled
+}
+
+// Scale returns img resampled to w x h as RGBA, or img itself if it already
+// has that size.
+func Scale(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// scaled returns w and h multiplied by s, if s shrinks them.
+func scaled(w, h int, s float64) (int, int) {
+	if s >= 1 {
+		return w, h
+	}
+	return max(1, int(math.Ceil(float64(w)*s))), max(1, int(math.Ceil(float64(h)*s)))
+}
+
+// Backdrop returns a small, blurred copy of img, at most size pixels on its
+// longer side, which stays soft when it is scaled up to cover an output.
+func Backdrop(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := Limit(b.Dx(), b.Dy(), size)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	// a few box blurs in each direction come close to a gaussian blur
+	for range 3 {
+		boxBlur(dst, 1, 0)
+		boxBlur(dst, 0, 1)
+	}
+	return dst
+}
+
+// boxBlur averages each pixel of img with its neighbours on either side in
+// the direction dx, dy, repeating the pixels along the edges.
+func boxBlur(img *image.RGBA, dx, dy int) {
+	src := slices.Clone(img.Pix)
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := range h {
+		for x := range w {
+			var sum [4]int
+			for d := -1; d <= 1; d++ {
+				sx := min(max(x+d*dx, 0), w-1)
+				sy := min(max(y+d*dy, 0), h-1)
+				i := sy*img.Stride + sx*4
+				for c := range 4 {
+					sum[c] += int(src[i+c])
+				}
+			}
+			i := y*img.Stride + x*4
+			for c := range 4 {
+				img.Pix[i+c] = uint8(sum[c] / 3)
+			}
+		}
+	}
+}
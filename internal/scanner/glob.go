@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// matchAny reports whether the slash separated relative path matches any of
+// the patterns.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether rel matches the glob pattern. Patterns use the
+// path.Match syntax for each path element, and a "**" element matches zero or
+// more directories. A pattern without a slash is matched against the file name
+// alone, so "*_thumb.*" excludes thumbnails at any depth.
+func match(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchParts(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchParts(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// collapse repeated ** and try every possible number of skipped elements
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// validatePattern checks that every element of a glob pattern is well formed.
+func validatePattern(pattern string) error {
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "**" {
+			continue
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
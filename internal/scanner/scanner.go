@@ -0,0 +1,187 @@
+// Package scanner discovers wallpaper images in a set of directories.
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/imageformat"
+)
+
+// Options controls which files a Scanner returns.
+type Options struct {
+	Recursive      bool     // descend into subdirectories
+	Include        []string // if set, only files matching one of these globs are returned
+	Exclude        []string // files matching any of these globs are skipped
+	FollowSymlinks bool     // follow symlinked files and directories
+	Hidden         bool     // include dot files and descend into dot directories
+}
+
+// Scanner walks wallpaper directories and returns the image files in them.
+type Scanner struct {
+	opts Options
+}
+
+// New creates a scanner with the given options. Invalid glob patterns are
+// reported here rather than silently never matching.
+func New(opts Options) (*Scanner, error) {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if err := validatePattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return &Scanner{opts: opts}, nil
+}
+
+// Scan returns the image files found in the given directories, in directory
+// order. Each directory must exist.
+func (s *Scanner) Scan(dirs ...string) ([]string, error) {
+	files, _, err := s.ScanTree(dirs...)
+	return files, err
+}
+
+// ScanTree is Scan that also returns every directory visited, so that a
+// watcher can start from the same scan instead of walking the tree again.
+func (s *Scanner) ScanTree(roots ...string) (files, dirs []string, err error) {
+	files = make([]string, 0)
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, nil, fmt.Errorf("wallpaper directory %v: %w", root, err)
+		}
+		if !info.IsDir() {
+			return nil, nil, fmt.Errorf("wallpaper directory %v is not a directory", root)
+		}
+
+		found, visited, err := s.ScanDir(root, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, found...)
+		dirs = append(dirs, visited...)
+	}
+	return files, dirs, nil
+}
+
+// ScanDir returns the accepted files in dir, which is either the wallpaper
+// directory root or a directory below it, along with every directory that was
+// visited. The directories are what a caller needs to watch for changes.
+func (s *Scanner) ScanDir(root, dir string) (files, dirs []string, err error) {
+	visited := make(map[string]bool)
+	files = make([]string, 0)
+	err = s.walk(root, dir, visited, &files, &dirs)
+	return files, dirs, err
+}
+
+// walk collects the accepted files and the directories below dir. Symlinked
+// directories are resolved and tracked in visited so that loops are only
+// traversed once.
+func (s *Scanner) walk(root, dir string, visited map[string]bool, files, dirs *[]string) error {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading wallpapers directory: %w", err)
+	}
+	*dirs = append(*dirs, dir)
+
+	for _, entry := range entries {
+		if !s.opts.Hidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			if !s.opts.FollowSymlinks {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Warnf("Skipping broken symlink %v: %v", path, err)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		if isDir {
+			if !s.opts.Recursive {
+				continue
+			}
+			if err := s.walk(root, path, visited, files, dirs); err != nil {
+				log.Warnf("Skipping %v: %v", path, err)
+			}
+			continue
+		}
+
+		if s.Accept(root, path) {
+			*files = append(*files, path)
+		}
+	}
+	return nil
+}
+
+// Accept reports whether the file at path, found under the wallpaper
+// directory root, should be used as a wallpaper. The path is checked against
+// the options first, then the start of the file is read to check that it is
+// a supported image format, whatever its extension.
+func (s *Scanner) Accept(root, path string) bool {
+	if !s.AcceptDir(root, filepath.Dir(path)) {
+		return false
+	}
+	if !s.opts.Hidden && strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if len(s.opts.Include) > 0 && !matchAny(s.opts.Include, rel) {
+		return false
+	}
+	if matchAny(s.opts.Exclude, rel) {
+		return false
+	}
+
+	return imageformat.IsImage(path)
+}
+
+// AcceptDir reports whether the scanner looks for wallpapers in dir, which is
+// the wallpaper directory root or a directory below it.
+func (s *Scanner) AcceptDir(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	if !s.opts.Recursive {
+		return false
+	}
+	if !s.opts.Hidden {
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			if strings.HasPrefix(part, ".") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Options returns the options the scanner was created with.
+func (s *Scanner) Options() Options {
+	return s.opts
+}
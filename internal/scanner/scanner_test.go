@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// makeTree builds a wallpaper directory with images, a file that is not an
+// image despite its name, hidden files, a symlink to a directory outside the
+// tree and a symlink loop. It returns the root of the tree.
+func makeTree(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "wallpapers")
+
+	files := map[string]string{
+		"a.png":             pngMagic,
+		"g":                 "\xff\xd8\xff\xe0", // a JPEG without an extension
+		"fake.png":          "not an image at all",
+		".hidden.png":       pngMagic,
+		".hiddendir/f.png":  pngMagic,
+		"nsfw/d.png":        pngMagic,
+		"sub/c.png":         pngMagic,
+		"sub/c_thumb.png":   pngMagic,
+		"sub/nsfw/e.png":    pngMagic,
+		"../outside/h.png":  pngMagic,
+		"../outside/readme": "text",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "extlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "recursive",
+			opts: Options{Recursive: true, FollowSymlinks: true},
+			want: []string{"a.png", "extlink/h.png", "g", "nsfw/d.png", "sub/c.png", "sub/c_thumb.png", "sub/nsfw/e.png"},
+		},
+		{
+			name: "not recursive",
+			opts: Options{FollowSymlinks: true},
+			want: []string{"a.png", "g"},
+		},
+		{
+			name: "exclude",
+			opts: Options{Recursive: true, FollowSymlinks: true, Exclude: []string{"**/nsfw/**", "*_thumb.*"}},
+			want: []string{"a.png", "extlink/h.png", "g", "sub/c.png"},
+		},
+		{
+			name: "include",
+			opts: Options{Recursive: true, FollowSymlinks: true, Include: []string{"sub/**"}},
+			want: []string{"sub/c.png", "sub/c_thumb.png", "sub/nsfw/e.png"},
+		},
+		{
+			name: "include and exclude",
+			opts: Options{Recursive: true, FollowSymlinks: true, Include: []string{"**/*.png"}, Exclude: []string{"sub/nsfw/**"}},
+			want: []string{"a.png", "extlink/h.png", "nsfw/d.png", "sub/c.png", "sub/c_thumb.png"},
+		},
+		{
+			name: "symlinks not followed",
+			opts: Options{Recursive: true},
+			want: []string{"a.png", "g", "nsfw/d.png", "sub/c.png", "sub/c_thumb.png", "sub/nsfw/e.png"},
+		},
+		{
+			name: "hidden",
+			opts: Options{Recursive: true, FollowSymlinks: true, Hidden: true},
+			want: []string{".hidden.png", ".hiddendir/f.png", "a.png", "extlink/h.png", "g", "nsfw/d.png", "sub/c.png", "sub/c_thumb.png", "sub/nsfw/e.png"},
+		},
+	}
+
+	root := makeTree(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := s.Scan(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(files))
+			for _, f := range files {
+				rel, err := filepath.Rel(root, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanMissingDirectory(t *testing.T) {
+	s, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Scan(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("scanning a missing directory succeeded")
+	}
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	if _, err := New(Options{Exclude: []string{"[unclosed"}}); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*_thumb.*", "a_thumb.jpg", true},
+		{"*_thumb.*", "deep/dir/a_thumb.png", true},
+		{"*_thumb.*", "thumb.png", false},
+		{"**/nsfw/**", "nsfw/a.png", true},
+		{"**/nsfw/**", "x/y/nsfw/z/a.png", true},
+		{"**/nsfw/**", "nsfw.png", false},
+		{"**/nsfw/**", "notnsfw/a.png", false},
+		{"sub/*.png", "sub/a.png", true},
+		{"sub/*.png", "sub/deeper/a.png", false},
+		{"a/**/b.png", "a/b.png", true},
+		{"a/**/b.png", "a/x/y/b.png", true},
+	}
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
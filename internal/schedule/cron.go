@@ -0,0 +1,192 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron is a parsed cron expression: minute, hour, day of the month, month
+// and day of the week, each a set of the values it matches.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // whether the field was "*", which changes how the days combine
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseCron parses a standard five field cron expression. Fields may be
+// "*", numbers, names of months and days, ranges such as "1-5", lists such
+// as "1,15" and steps such as "*/15" or "9-17/2".
+func parseCron(expr string) (*cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, not %d", expr, len(fields))
+	}
+
+	var c cron
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59, nil, 0); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil, 0); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil, 0); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12, monthNames, 1); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	// 7 is Sunday as well as 0
+	if c.dow, err = parseField(fields[4], 0, 7, dayNames, 0); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return &c, nil
+}
+
+// parseField parses one field of a cron expression into the set of values
+// from lo to hi it matches. names, if given, name the values from base up.
+func parseField(field string, lo, hi int, names []string, base int) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return i + base, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("%q is not a value from %d to %d", s, lo, hi)
+		}
+		return n, nil
+	}
+
+	var set uint64
+	for part := range strings.SplitSeq(field, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%q is not a valid step", stepText)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		if span != "*" {
+			from, to, isRange := strings.Cut(span, "-")
+			var err error
+			if start, err = value(from); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = hi
+			}
+			if end < start {
+				return 0, fmt.Errorf("range %q runs backwards", span)
+			}
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// matches reports whether the expression matches the minute of t.
+func (c *cron) matches(t time.Time) bool {
+	return c.minute&(1<<t.Minute()) != 0 && c.hour&(1<<t.Hour()) != 0 && c.matchesDay(t)
+}
+
+// matchesDay reports whether the expression matches the day of t. As in
+// cron, when both the day of the month and the day of the week are given,
+// either one matching is enough.
+func (c *cron) matchesDay(t time.Time) bool {
+	if c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first minute after t that the expression matches, or
+// false if it does not match again until after limit. Only the days that
+// match are searched, and only the hours and minutes of the expression on
+// them.
+func (c *cron) next(t, limit time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for day := midnight(t); !day.After(limit); day = day.AddDate(0, 0, 1) {
+		if !c.matchesDay(day) {
+			continue
+		}
+		y, mon, d := day.Date()
+		for h := 0; h < 24; h++ {
+			if c.hour&(1<<h) == 0 || day.Equal(midnight(t)) && h < t.Hour() {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if c.minute&(1<<m) == 0 {
+					continue
+				}
+				at := time.Date(y, mon, d, h, m, 0, 0, day.Location())
+				// a minute skipped by a daylight saving change does not match
+				if at.Before(t) || !c.matches(at) {
+					continue
+				}
+				return at, !at.After(limit)
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// prev returns the last minute at or before t that the expression matches,
+// or false if it last matched before limit.
+func (c *cron) prev(t, limit time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	for day := midnight(t); !day.Before(midnight(limit)); day = day.AddDate(0, 0, -1) {
+		if !c.matchesDay(day) {
+			continue
+		}
+		y, mon, d := day.Date()
+		for h := 23; h >= 0; h-- {
+			if c.hour&(1<<h) == 0 || day.Equal(midnight(t)) && h > t.Hour() {
+				continue
+			}
+			for m := 59; m >= 0; m-- {
+				if c.minute&(1<<m) == 0 {
+					continue
+				}
+				at := time.Date(y, mon, d, h, m, 0, 0, day.Location())
+				if at.After(t) || !c.matches(at) {
+					continue
+				}
+				return at, !at.Before(limit)
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// midnight returns the start of the day of t.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
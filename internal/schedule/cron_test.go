@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"*/15 9-17 * * mon-fri", june(2, 9, 30), true},
+		{"*/15 9-17 * * mon-fri", june(2, 9, 31), false},
+		{"*/15 9-17 * * mon-fri", june(2, 18, 0), false},
+		{"*/15 9-17 * * mon-fri", june(7, 9, 30), false},
+		{"0 0 1 * *", june(1, 0, 0), true},
+		{"0 0 1 * *", june(2, 0, 0), false},
+		{"30 8 * jun sun", june(1, 8, 30), true},
+		{"30 8 * jul sun", june(1, 8, 30), false},
+		{"0 0 * * 7", june(1, 0, 0), true},
+		{"0 0 * * 0", june(1, 0, 0), true},
+		{"5,10-12/2 * * * *", june(2, 3, 11), false},
+		{"5,10-12/2 * * * *", june(2, 3, 12), true},
+		{"5,10-12/2 * * * *", june(2, 3, 5), true},
+		{"20/20 * * * *", june(2, 3, 40), true},
+		{"20/20 * * * *", june(2, 3, 0), false},
+
+		// when both days are given, either one is enough
+		{"0 12 13 * fri", june(6, 12, 0), true},
+		{"0 12 13 * fri", june(13, 12, 0), true},
+		{"0 12 13 * fri", time.Date(2025, time.May, 13, 12, 0, 0, 0, time.UTC), true},
+		{"0 12 13 * fri", june(4, 12, 0), false},
+		// and when one is "*", the other must match
+		{"0 12 13 * *", june(6, 12, 0), false},
+		{"0 12 * * fri", june(13, 12, 0), true},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.matches(tt.at); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * funday",
+		"* * * foo *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+// TestCronNextPrev checks next and prev against matching every minute in
+// turn, across the end of the month and a daylight saving change.
+func TestCronNextPrev(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	starts := []time.Time{
+		june(2, 10, 0),
+		june(29, 23, 59).Add(30 * time.Second),
+		time.Date(2025, time.March, 29, 12, 0, 0, 0, berlin),
+	}
+	for _, expr := range []string{
+		"* * * * *",
+		"*/15 9-17 * * mon-fri",
+		"30 2 * * *",
+		"0 0 1 * *",
+		"0 12 13 * fri",
+		"0 0 29 feb *",
+	} {
+		c, err := parseCron(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, start := range starts {
+			limit := start.Add(3 * 24 * time.Hour)
+			var want time.Time
+			for m := start.Truncate(time.Minute).Add(time.Minute); !m.After(limit); m = m.Add(time.Minute) {
+				if c.matches(m) {
+					want = m
+					break
+				}
+			}
+			got, ok := c.next(start, limit)
+			if ok != !want.IsZero() || ok && !got.Equal(want) {
+				t.Errorf("%q next after %v = %v, %v, want %v", expr, start, got, ok, want)
+			}
+
+			limit = start.Add(-3 * 24 * time.Hour)
+			want = time.Time{}
+			for m := start.Truncate(time.Minute); !m.Before(limit); m = m.Add(-time.Minute) {
+				if c.matches(m) {
+					want = m
+					break
+				}
+			}
+			got, ok = c.prev(start, limit)
+			if ok != !want.IsZero() || ok && !got.Equal(want) {
+				t.Errorf("%q prev before %v = %v, %v, want %v", expr, start, got, ok, want)
+			}
+		}
+	}
+}
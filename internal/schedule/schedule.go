@@ -0,0 +1,471 @@
+// Package schedule works out which set of wallpapers is in effect at a given
+// time, from rules that cover ranges of days and times, which may follow the
+// sun, or start at the times a cron expression matches.
+package schedule
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/matjam/smoothpaper/internal/solar"
+)
+
+// Rule is one [[schedule]] block of the configuration. A rule either covers
+// days and a range of times, or starts whenever its cron expression matches
+// and stays in effect until another rule starts.
+type Rule struct {
+	Name       string   `mapstructure:"name"`
+	Days       []string `mapstructure:"days"`       // days such as "mon-fri" or "sat"; every day if empty
+	From       string   `mapstructure:"from"`       // "HH:MM" or a solar event the rule starts at; midnight if empty
+	To         string   `mapstructure:"to"`         // "HH:MM" or a solar event the rule ends at, the next day if before From; midnight if empty
+	Cron       string   `mapstructure:"cron"`       // cron expression the rule starts at, instead of days and times
+	Wallpapers []string `mapstructure:"wallpapers"` // directories shown while the rule is in effect; the global ones if empty
+	Timelapse  string   `mapstructure:"timelapse"`  // directory of a time-lapse that follows the sun, shown instead of the wallpapers
+	Delay      int      `mapstructure:"delay"`      // seconds between wallpapers; the global delay if 0
+	FadeSpeed  int      `mapstructure:"fade_speed"` // seconds a transition takes; the global fade speed if 0
+
+	// Frames are the images of the time-lapse, found in the Timelapse
+	// directory by the caller. New puts them in order.
+	Frames []string `mapstructure:"-"`
+}
+
+// Clock returns the current time. It is time.Now except in tests.
+type Clock func() time.Time
+
+// horizon is how far back a cron rule is looked for, and how far ahead Next
+// looks for a change. A cron rule that matches less than monthly, such as one
+// for a particular month, is forgotten a month after it starts.
+const horizon = 31 * 24 * time.Hour
+
+// Schedule is a list of rules. When rules overlap, a range rule takes
+// precedence over a cron rule and an earlier rule over a later one.
+type Schedule struct {
+	rules    []rule
+	clock    Clock
+	location *solar.Location // where the sun is followed from, nil if not configured
+
+	minute time.Time // the minute the active rule was last looked up for
+	active *Rule
+
+	mu        sync.Mutex
+	solarDays map[solarDay][2]time.Duration // when the sun passes each event, by day, as solar.Times returns
+}
+
+// solarDay is a day and a solar event, which the sun passes at the same
+// times all day.
+type solarDay struct {
+	year, yearDay int
+	event         solar.Event
+}
+
+type rule struct {
+	Rule
+	days     [7]bool
+	from, to timeOfDay
+	allDay   bool
+	cron     *cron
+}
+
+// timeOfDay is a fixed time, or a time relative to a solar event.
+type timeOfDay struct {
+	minutes int          // minutes since midnight, or the offset from the event
+	event   *solar.Event // the event the time follows, nil for a fixed time
+	rising  bool         // whether the event is the morning one
+}
+
+// solarEvents are the names of the solar events a time of day may follow.
+var solarEvents = map[string]struct {
+	event  solar.Event
+	rising bool
+}{
+	"sunrise": {solar.Sunrise, true},
+	"sunset":  {solar.Sunrise, false},
+	"dawn":    {solar.Dawn, true},
+	"dusk":    {solar.Dawn, false},
+}
+
+// New parses the rules, which are used in the order given, and returns a
+// schedule that tells the time with clock. Rules that follow the sun need
+// location, which may otherwise be nil.
+func New(rules []Rule, location *solar.Location, clock Clock) (*Schedule, error) {
+	s := &Schedule{clock: clock, location: location}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("schedule %d", i+1)
+		}
+		parsed, err := parseRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		if location == nil && (parsed.from.event != nil || parsed.to.event != nil || r.Timelapse != "") {
+			return nil, fmt.Errorf("%s: latitude and longitude must be set to follow the sun", r.Name)
+		}
+		s.rules = append(s.rules, parsed)
+	}
+	return s, nil
+}
+
+func parseRule(r Rule) (rule, error) {
+	p := rule{Rule: r}
+	if r.Timelapse != "" {
+		if len(r.Frames) < 2 {
+			return p, fmt.Errorf("a time-lapse needs at least 2 images in %v", r.Timelapse)
+		}
+		p.Frames = slices.Clone(r.Frames)
+		slices.SortFunc(p.Frames, compareFrames)
+	}
+	if r.Cron != "" {
+		if len(r.Days) > 0 || r.From != "" || r.To != "" {
+			return p, fmt.Errorf("cron cannot be combined with days, from or to")
+		}
+		var err error
+		if p.cron, err = parseCron(r.Cron); err != nil {
+			return p, err
+		}
+		return p, nil
+	}
+
+	if len(r.Days) == 0 {
+		p.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, days := range r.Days {
+		if err := parseDays(days, &p.days); err != nil {
+			return p, err
+		}
+	}
+	var err error
+	if p.from, err = parseTime(r.From); err != nil {
+		return p, err
+	}
+	if p.to, err = parseTime(r.To); err != nil {
+		return p, err
+	}
+	p.allDay = p.from.event == nil && p.to.event == nil && p.from.minutes == p.to.minutes
+	return p, nil
+}
+
+// compareFrames orders the frames of a time-lapse by name, comparing runs of
+// digits by their value so that "frame2" comes before "frame10".
+func compareFrames(a, b string) int {
+	a, b = filepath.Base(a), filepath.Base(b)
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.ParseUint(da, 10, 64)
+			nb, _ := strconv.ParseUint(db, 10, 64)
+			if c := cmp.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if c := cmp.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func leadingDigits(s string) string {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i < 0 {
+		return s
+	}
+	return s[:i]
+}
+
+// parseDays marks the days named by s, a day such as "sat" or a range such as
+// "mon-fri" or "fri-mon".
+func parseDays(s string, days *[7]bool) error {
+	from, to, isRange := strings.Cut(s, "-")
+	first, err := parseDay(from)
+	if err != nil {
+		return err
+	}
+	last := first
+	if isRange {
+		if last, err = parseDay(to); err != nil {
+			return err
+		}
+	}
+	for d := first; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == last {
+			return nil
+		}
+	}
+}
+
+func parseDay(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range dayNames {
+		if strings.HasPrefix(s, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a day of the week", s)
+}
+
+// parseTime parses a time of day given as "HH:MM", or as "sunrise", "sunset",
+// "dawn" or "dusk" with an optional offset such as "sunset+30m" or
+// "sunrise-1h".
+func parseTime(s string) (timeOfDay, error) {
+	if s == "" {
+		return timeOfDay{}, nil
+	}
+	name, offset, sign := s, "", 1
+	if i := strings.IndexAny(s, "+-"); i > 0 {
+		name, offset = s[:i], s[i+1:]
+		if s[i] == '-' {
+			sign = -1
+		}
+	}
+	if e, ok := solarEvents[strings.ToLower(strings.TrimSpace(name))]; ok {
+		t := timeOfDay{event: &e.event, rising: e.rising}
+		if offset != "" {
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return t, fmt.Errorf("%q is not a valid offset from %v", offset, name)
+			}
+			t.minutes = sign * int(d.Minutes())
+		}
+		return t, nil
+	}
+
+	h, m, ok := strings.Cut(s, ":")
+	hour, herr := strconv.Atoi(h)
+	minute, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || hour == 24 && minute > 0 {
+		return timeOfDay{}, fmt.Errorf("%q is not a time of day as HH:MM or a solar event such as sunset+30m", s)
+	}
+	return timeOfDay{minutes: hour*60 + minute}, nil
+}
+
+// at returns the time of day on the day of t as minutes since midnight.
+func (td timeOfDay) at(t time.Time, s *Schedule) int {
+	if td.event == nil {
+		return td.minutes
+	}
+	rise, set := s.solarTimes(t, *td.event)
+	event := set
+	if td.rising {
+		event = rise
+	}
+	return min(max(int(event.Minutes())+td.minutes, 0), 24*60)
+}
+
+// covers reports whether the minute of t falls in the days and times of a
+// range rule. A range that runs past midnight belongs to the day it starts on.
+func (r *rule) covers(t time.Time, s *Schedule) bool {
+	day := int(t.Weekday())
+	if r.allDay {
+		return r.days[day]
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if r.days[day] {
+		from, to := r.from.at(t, s), r.to.at(t, s)
+		if from < to && minute >= from && minute < to || from > to && minute >= from {
+			return true
+		}
+	}
+	yesterday := t.AddDate(0, 0, -1)
+	if r.days[int(yesterday.Weekday())] {
+		from, to := r.from.at(yesterday, s), r.to.at(yesterday, s)
+		if from > to && minute < to {
+			return true
+		}
+	}
+	return false
+}
+
+// solarTimes returns when the sun passes event on the day of t, as
+// solar.Times does. The times are only worked out once for each day, as
+// looking up the rule in effect needs them again and again.
+func (s *Schedule) solarTimes(t time.Time, event solar.Event) (rise, set time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := solarDay{t.Year(), t.YearDay(), event}
+	if times, ok := s.solarDays[key]; ok {
+		return times[0], times[1]
+	}
+	// Next needs little more than the days up to a month ahead
+	if s.solarDays == nil || len(s.solarDays) > 128 {
+		s.solarDays = make(map[solarDay][2]time.Duration)
+	}
+	rise, set = solar.Times(t, *s.location, event)
+	s.solarDays[key] = [2]time.Duration{rise, set}
+	return rise, set
+}
+
+// Rules returns the rules of the schedule.
+func (s *Schedule) Rules() []Rule {
+	rules := make([]Rule, len(s.rules))
+	for i := range s.rules {
+		rules[i] = s.rules[i].Rule
+	}
+	return rules
+}
+
+// Location returns where the sun is followed from, or nil if it is not set.
+func (s *Schedule) Location() *solar.Location {
+	return s.location
+}
+
+// Now returns the current time from the schedule's clock.
+func (s *Schedule) Now() time.Time {
+	return s.clock()
+}
+
+// At returns the rule in effect at t, or nil if none is and the global
+// settings apply.
+func (s *Schedule) At(t time.Time) *Rule {
+	t = t.Truncate(time.Minute)
+	if r := s.rangeAt(t); r != nil {
+		return r
+	}
+	return s.lastCron(t)
+}
+
+// lastCron returns the cron rule that started most recently at or before t.
+// Of rules that started at the same minute, the earlier one is returned.
+func (s *Schedule) lastCron(t time.Time) *Rule {
+	var last *Rule
+	var lastAt time.Time
+	for i := range s.rules {
+		if s.rules[i].cron == nil {
+			continue
+		}
+		at, ok := s.rules[i].cron.prev(t, t.Add(-horizon))
+		if ok && (last == nil || at.After(lastAt)) {
+			last, lastAt = &s.rules[i].Rule, at
+		}
+	}
+	return last
+}
+
+func (s *Schedule) rangeAt(t time.Time) *Rule {
+	for i := range s.rules {
+		if s.rules[i].cron == nil && s.rules[i].covers(t, s) {
+			return &s.rules[i].Rule
+		}
+	}
+	return nil
+}
+
+func (s *Schedule) cronAt(t time.Time) *Rule {
+	for i := range s.rules {
+		if s.rules[i].cron != nil && s.rules[i].cron.matches(t) {
+			return &s.rules[i].Rule
+		}
+	}
+	return nil
+}
+
+// Next returns when the rule in effect next changes and the rule in effect
+// from then, nil for the global settings. ok is false if it does not change
+// within a month.
+func (s *Schedule) Next() (at time.Time, next *Rule, ok bool) {
+	now := s.clock().Truncate(time.Minute)
+	active := s.At(now)
+	for _, m := range s.changes(now, now.Add(horizon)) {
+		if r := s.At(m); r != active {
+			return m, r, true
+		}
+	}
+	return time.Time{}, nil, false
+}
+
+// changes returns, in order, the minutes after from and up to to at which
+// the rule in effect may change: the starts and ends of the ranges, midnight,
+// when the days of the ranges change, and the minutes at which a different
+// cron rule starts.
+func (s *Schedule) changes(from, to time.Time) []time.Time {
+	var changes []time.Time
+	add := func(t time.Time) {
+		if t.After(from) && !t.After(to) {
+			changes = append(changes, t)
+		}
+	}
+
+	// a range that runs past midnight ends on the day after the one it
+	// starts on, at the time worked out for the day it starts on
+	for day := midnight(from).AddDate(0, 0, -1); !day.After(to); day = day.AddDate(0, 0, 1) {
+		add(day)
+		y, m, d := day.Date()
+		for i := range s.rules {
+			r := &s.rules[i]
+			if r.cron != nil || r.allDay {
+				continue
+			}
+			add(time.Date(y, m, d, 0, r.from.at(day, s), 0, 0, day.Location()))
+			add(time.Date(y, m, d, 0, r.to.at(day, s), 0, 0, day.Location()))
+			add(time.Date(y, m, d+1, 0, r.to.at(day, s), 0, 0, day.Location()))
+		}
+	}
+
+	// a cron rule matching again while it applies changes nothing, so only
+	// the other rules are looked at
+	started := s.lastCron(from)
+	for t := from; ; {
+		var first time.Time
+		found := false
+		for i := range s.rules {
+			r := &s.rules[i]
+			if r.cron == nil || &r.Rule == started {
+				continue
+			}
+			if at, ok := r.cron.next(t, to); ok && (!found || at.Before(first)) {
+				first, found = at, true
+			}
+		}
+		if !found {
+			break
+		}
+		if r := s.cronAt(first); r != started {
+			add(first)
+			started = r
+		}
+		t = first
+	}
+
+	slices.SortFunc(changes, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(changes, time.Time.Equal)
+}
+
+// Frame returns the frame of the rule's time-lapse to show now, or "" if the
+// rule has no time-lapse. The frame is picked by the sun's elevation, as
+// solar.Phase maps it between the lowest and highest it reaches that day: the
+// first half of the frames are shown as the sun climbs from its lowest, at
+// solar midnight, and the second half as it sinks again from its highest, at
+// solar noon, when the middle frame is shown.
+func (s *Schedule) Frame(r *Rule) string {
+	if r == nil || len(r.Frames) == 0 || s.location == nil {
+		return ""
+	}
+	phase := solar.Phase(s.clock(), *s.location)
+	return r.Frames[int(phase*float64(len(r.Frames)))%len(r.Frames)]
+}
+
+// Update returns the rule in effect now, and whether it differs from the one
+// returned last time. It is cheap to call often, as it only looks the rule up
+// again once the minute has changed.
+func (s *Schedule) Update() (*Rule, bool) {
+	now := s.clock().Truncate(time.Minute)
+	if now.Equal(s.minute) {
+		return s.active, false
+	}
+	s.minute = now
+	r := s.At(now)
+	changed := r != s.active
+	s.active = r
+	return r, changed
+}
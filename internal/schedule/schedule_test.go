@@ -0,0 +1,273 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matjam/smoothpaper/internal/solar"
+)
+
+// june returns a minute in June 2025, in UTC. The 2nd is a Monday.
+func june(day, hour, minute int) time.Time {
+	return time.Date(2025, time.June, day, hour, minute, 0, 0, time.UTC)
+}
+
+// fakeClock is a clock that tells the time it is set to.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newSchedule(t *testing.T, rules []Rule, location *solar.Location, clock *fakeClock) *Schedule {
+	t.Helper()
+	s, err := New(rules, location, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// name returns the name of a rule, or "" for the global settings.
+func name(r *Rule) string {
+	if r == nil {
+		return ""
+	}
+	return r.Name
+}
+
+var rangeRules = []Rule{
+	{Name: "work", Days: []string{"mon-fri"}, From: "09:00", To: "17:00"},
+	{Name: "friday night", Days: []string{"fri"}, From: "23:00", To: "02:00"},
+	{Name: "night", From: "22:00", To: "06:00"},
+	{Name: "weekend", Days: []string{"sat", "sun"}},
+}
+
+var cronRules = []Rule{
+	{Name: "lunch", From: "12:00", To: "13:00"},
+	{Name: "morning", Cron: "0 8 * * *"},
+	{Name: "evening", Cron: "0 20 * * *"},
+}
+
+func TestAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		at    time.Time
+		want  string
+	}{
+		{"in a range", rangeRules, june(2, 10, 0), "work"},
+		{"before a range", rangeRules, june(2, 8, 59), ""},
+		{"end of a range", rangeRules, june(2, 17, 0), ""},
+		{"before midnight", rangeRules, june(2, 23, 30), "night"},
+		{"after midnight", rangeRules, june(3, 3, 0), "night"},
+		{"end after midnight", rangeRules, june(3, 6, 0), ""},
+		{"earlier rule first", rangeRules, june(6, 23, 30), "friday night"},
+		{"after midnight on the next day", rangeRules, june(7, 1, 30), "friday night"},
+		{"all day", rangeRules, june(7, 10, 0), "weekend"},
+		{"not past midnight on other days", rangeRules, june(8, 1, 30), "night"},
+		{"all day on the last day", rangeRules, june(8, 6, 0), "weekend"},
+
+		{"cron before the first start", cronRules, june(2, 7, 59), "evening"},
+		{"cron start", cronRules, june(2, 8, 0), "morning"},
+		{"cron stays until the next", cronRules, june(2, 11, 59), "morning"},
+		{"range over cron", cronRules, june(2, 12, 30), "lunch"},
+		{"cron after a range", cronRules, june(2, 13, 0), "morning"},
+		{"next cron", cronRules, june(2, 20, 0), "evening"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSchedule(t, tt.rules, nil, &fakeClock{})
+			if got := name(s.At(tt.at)); got != tt.want {
+				t.Errorf("At(%v) = %q, want %q", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		now    time.Time
+		wantAt time.Time
+		want   string
+	}{
+		{"inside a range", rangeRules, june(2, 10, 0), june(2, 17, 0), ""},
+		{"at the start of a range", rangeRules, june(2, 9, 0), june(2, 17, 0), ""},
+		{"within the minute before a change", rangeRules, june(2, 16, 59).Add(30 * time.Second), june(2, 17, 0), ""},
+		{"at the end of a range", rangeRules, june(2, 17, 0), june(2, 22, 0), "night"},
+		{"across midnight", rangeRules, june(2, 23, 0), june(3, 6, 0), ""},
+		{"into a range past midnight", rangeRules, june(6, 17, 0), june(6, 22, 0), "night"},
+		{"between ranges past midnight", rangeRules, june(6, 22, 30), june(6, 23, 0), "friday night"},
+		{"from one range into another past midnight", rangeRules, june(7, 1, 0), june(7, 2, 0), "night"},
+		{"into an all day range", rangeRules, june(7, 2, 0), june(7, 6, 0), "weekend"},
+
+		{"to a cron rule", cronRules, june(2, 19, 0), june(2, 20, 0), "evening"},
+		{"into a range from cron", cronRules, june(2, 8, 0), june(2, 12, 0), "lunch"},
+		{"back to cron after a range", cronRules, june(2, 12, 30), june(2, 13, 0), "morning"},
+		{"cron across midnight", cronRules, june(2, 20, 0), june(3, 8, 0), "morning"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSchedule(t, tt.rules, nil, &fakeClock{now: tt.now})
+			at, next, ok := s.Next()
+			if !ok {
+				t.Fatal("Next found no change")
+			}
+			if !at.Equal(tt.wantAt) || name(next) != tt.want {
+				t.Errorf("Next() = %v, %q, want %v, %q", at, name(next), tt.wantAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextNoChange(t *testing.T) {
+	s := newSchedule(t, []Rule{{Name: "always"}}, nil, &fakeClock{now: june(2, 10, 0)})
+	if at, next, ok := s.Next(); ok {
+		t.Errorf("Next() = %v, %q, want no change", at, name(next))
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	clock := &fakeClock{now: june(2, 8, 59)}
+	s := newSchedule(t, rangeRules, nil, clock)
+
+	steps := []struct {
+		now         time.Time
+		want        string
+		wantChanged bool
+	}{
+		{june(2, 8, 59), "", false}, // the global settings were in effect already
+		{june(2, 9, 0), "work", true},
+		{june(2, 9, 0).Add(30 * time.Second), "work", false},
+		{june(2, 12, 0), "work", false},
+		{june(2, 17, 0), "", true},
+	}
+	for _, step := range steps {
+		clock.now = step.now
+		r, changed := s.Update()
+		if name(r) != step.want || changed != step.wantChanged {
+			t.Errorf("at %v: Update() = %q, %v, want %q, %v", step.now, name(r), changed, step.want, step.wantChanged)
+		}
+	}
+}
+
+func TestSolarOffsets(t *testing.T) {
+	london := &solar.Location{Latitude: 51.5, Longitude: -0.13}
+	rules := []Rule{{Name: "day", From: "sunrise+30m", To: "sunset-1h"}}
+	s := newSchedule(t, rules, london, &fakeClock{now: june(2, 0, 0)})
+
+	rise, set := solar.Times(june(2, 0, 0), *london, solar.Sunrise)
+	midnight := june(2, 0, 0)
+	from := midnight.Add(time.Duration(int(rise.Minutes())+30) * time.Minute)
+	to := midnight.Add(time.Duration(int(set.Minutes())-60) * time.Minute)
+	if from.Hour() < 4 || from.Hour() > 5 || to.Hour() < 19 || to.Hour() > 20 {
+		t.Fatalf("sunrise+30m at %v and sunset-1h at %v are not around 04:30 and 20:00", from, to)
+	}
+
+	checks := []struct {
+		at   time.Time
+		want string
+	}{
+		{from.Add(-time.Minute), ""},
+		{from, "day"},
+		{to.Add(-time.Minute), "day"},
+		{to, ""},
+	}
+	for _, c := range checks {
+		if got := name(s.At(c.at)); got != c.want {
+			t.Errorf("At(%v) = %q, want %q", c.at, got, c.want)
+		}
+	}
+
+	at, next, ok := s.Next()
+	if !ok || !at.Equal(from) || name(next) != "day" {
+		t.Errorf("Next() = %v, %q, %v, want %v, \"day\"", at, name(next), ok, from)
+	}
+}
+
+// TestSolarEventThatNeverHappens checks rules that follow the sun where it
+// does not rise or set that day: a rule from sunrise to sunset is in effect
+// all through the polar day and never in the polar night, and one from sunset
+// to sunrise the other way round.
+func TestSolarEventThatNeverHappens(t *testing.T) {
+	tromso := &solar.Location{Latitude: 69.65, Longitude: 18.96}
+	rules := []Rule{
+		{Name: "day", From: "sunrise", To: "sunset"},
+		{Name: "night", From: "sunset", To: "sunrise"},
+	}
+	s := newSchedule(t, rules, tromso, &fakeClock{now: june(21, 0, 0)})
+
+	december := func(hour, minute int) time.Time {
+		return time.Date(2025, time.December, 21, hour, minute, 0, 0, time.UTC)
+	}
+	checks := []struct {
+		at   time.Time
+		want string
+	}{
+		{june(21, 0, 0), "day"},
+		{june(21, 12, 0), "day"},
+		{june(21, 23, 59), "day"},
+		{december(0, 0), "night"},
+		{december(11, 0), "night"},
+		{december(23, 59), "night"},
+	}
+	for _, c := range checks {
+		if got := name(s.At(c.at)); got != c.want {
+			t.Errorf("At(%v) = %q, want %q", c.at, got, c.want)
+		}
+	}
+}
+
+// TestNextEveryMinute checks that Next finds the same change as looking the
+// rule up for every minute in turn, with rules that follow the sun, run past
+// midnight, cover whole days and start at cron times.
+func TestNextEveryMinute(t *testing.T) {
+	london := &solar.Location{Latitude: 51.5, Longitude: -0.13}
+	rules := []Rule{
+		{Name: "dawn", Days: []string{"mon-fri"}, From: "dawn", To: "sunrise+15m"},
+		{Name: "late", Days: []string{"fri"}, From: "sunset+2h", To: "01:30"},
+		{Name: "sunday", Days: []string{"sun"}},
+		{Name: "hourly", Cron: "0 * * * sat"},
+		{Name: "noon", Cron: "0 12 * * *"},
+		{Name: "monthly", Cron: "0 0 1 * *"},
+	}
+	clock := &fakeClock{}
+	s := newSchedule(t, rules, london, clock)
+
+	for now := june(1, 0, 0); now.Before(june(10, 0, 0)); now = now.Add(97 * time.Minute) {
+		clock.now = now
+		active := s.At(now)
+		var wantAt time.Time
+		var want *Rule
+		for m := now.Add(time.Minute); !m.After(now.Add(horizon)); m = m.Add(time.Minute) {
+			if r := s.At(m); r != active {
+				wantAt, want = m, r
+				break
+			}
+		}
+
+		at, next, ok := s.Next()
+		if !ok || !at.Equal(wantAt) || next != want {
+			t.Errorf("at %v: Next() = %v, %q, %v, want %v, %q", now, at, name(next), ok, wantAt, name(want))
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string][]Rule{
+		"sun without a location":    {{From: "sunset", To: "23:00"}},
+		"bad time":                  {{From: "25:00"}},
+		"bad offset":                {{From: "sunset+soon"}},
+		"bad day":                   {{Days: []string{"someday"}}},
+		"cron with times":           {{Cron: "0 8 * * *", From: "08:00"}},
+		"bad cron":                  {{Cron: "0 8 * *"}},
+		"time-lapse without frames": {{Timelapse: "/tmp/frames"}},
+	}
+	for desc, rules := range tests {
+		if _, err := New(rules, nil, time.Now); err == nil {
+			t.Errorf("%s: New succeeded", desc)
+		}
+	}
+}
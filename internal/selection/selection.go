@@ -0,0 +1,398 @@
+// Package selection decides the order wallpapers are shown in. The manager
+// keeps the wallpapers in a list and asks the strategy which of those it can
+// show comes next, and the shown one moves to the end; a strategy arranges
+// the list so that the first one is usually the one to show next. Keeping
+// the order in the list means the upcoming wallpapers can be prefetched and
+// the order saved across restarts.
+package selection
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+// Strategy arranges the list of wallpapers. All of its randomness comes from
+// the generator it was created with, so a seeded one makes it repeatable.
+type Strategy interface {
+	// Arrange puts a newly loaded list in the order it is to be shown in.
+	Arrange(wallpapers []string)
+	// Insert adds a wallpaper to the list and returns the list.
+	Insert(wallpapers []string, wallpaper string) []string
+	// Next returns the index of the wallpaper to show next among those
+	// accept allows, or -1 if it allows none. It may rearrange the list
+	// first, such as to start a new cycle.
+	Next(wallpapers []string, accept func(string) bool) int
+	// Shown is called once wallpapers[i] has been shown. It moves it to the
+	// end and arranges the wallpapers that come next.
+	Shown(wallpapers []string, i int)
+	// State returns what the strategy remembers about the wallpapers beyond
+	// the order of the list, so that it can be saved across restarts.
+	State(wallpapers []string) State
+	// Restore brings back the state saved by State.
+	Restore(state State)
+}
+
+// State is what a strategy remembers about the wallpapers beyond the order
+// of the list. Each strategy only uses the fields it needs.
+type State struct {
+	Shown map[string]uint64 `json:"shown,omitempty"` // least-recent: the show each wallpaper was last seen at, counting from 1
+	Cycle []string          `json:"cycle,omitempty"` // reshuffle: the wallpapers shown in the current cycle
+}
+
+// Weight makes the wallpapers in a directory, or a single file, more or less
+// likely to be shown by the weighted strategy.
+type Weight struct {
+	Path   string  `mapstructure:"path"`
+	Weight float64 `mapstructure:"weight"`
+}
+
+// New returns the named strategy. The weights are only used by the weighted
+// strategy; wallpapers they do not cover have a weight of 1.
+func New(name types.Selection, weights []Weight, rng *rand.Rand) (Strategy, error) {
+	switch name {
+	case types.SelectionSequential:
+		return sequential{}, nil
+	case types.SelectionShuffle:
+		return &shuffle{rng: rng}, nil
+	case types.SelectionReshuffle:
+		return &reshuffle{shuffle: shuffle{rng: rng}, cycle: make(map[string]bool)}, nil
+	case types.SelectionWeighted:
+		for _, w := range weights {
+			if w.Weight <= 0 {
+				return nil, fmt.Errorf("the weight of %v must be more than 0, not %v", w.Path, w.Weight)
+			}
+		}
+		return &weighted{shuffle: shuffle{rng: rng}, weights: weights}, nil
+	case types.SelectionLeastRecent:
+		return &leastRecent{shuffle: shuffle{rng: rng}, shown: make(map[string]uint64)}, nil
+	}
+	return nil, fmt.Errorf("unknown selection %q", name)
+}
+
+// first returns the index of the first wallpaper accept allows, or -1.
+func first(wallpapers []string, accept func(string) bool) int {
+	for i, w := range wallpapers {
+		if accept(w) {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveToEnd moves wallpapers[i] to the end, keeping the others in order.
+func moveToEnd(wallpapers []string, i int) {
+	w := wallpapers[i]
+	copy(wallpapers[i:], wallpapers[i+1:])
+	wallpapers[len(wallpapers)-1] = w
+}
+
+// moveToFront moves wallpapers[i] to the front, keeping the others in order.
+func moveToFront(wallpapers []string, i int) {
+	w := wallpapers[i]
+	copy(wallpapers[1:i+1], wallpapers[:i])
+	wallpapers[0] = w
+}
+
+// insertAt inserts wallpaper at position i and returns the list.
+func insertAt(wallpapers []string, i int, wallpaper string) []string {
+	wallpapers = append(wallpapers, "")
+	copy(wallpapers[i+1:], wallpapers[i:])
+	wallpapers[i] = wallpaper
+	return wallpapers
+}
+
+// sequential shows the wallpapers in the order they were found, over and
+// over.
+type sequential struct{}
+
+func (sequential) Arrange([]string) {}
+
+func (sequential) Insert(wallpapers []string, wallpaper string) []string {
+	return append(wallpapers, wallpaper)
+}
+
+func (sequential) Next(wallpapers []string, accept func(string) bool) int {
+	return first(wallpapers, accept)
+}
+
+func (sequential) Shown(wallpapers []string, i int) {
+	moveToEnd(wallpapers, i)
+}
+
+func (sequential) State([]string) State { return State{} }
+func (sequential) Restore(State)        {}
+
+// shuffle shuffles the wallpapers once and then shows them in that order,
+// over and over. New wallpapers are placed at random.
+type shuffle struct {
+	rng *rand.Rand
+}
+
+func (s *shuffle) Arrange(wallpapers []string) {
+	s.rng.Shuffle(len(wallpapers), func(i, j int) {
+		wallpapers[i], wallpapers[j] = wallpapers[j], wallpapers[i]
+	})
+}
+
+func (s *shuffle) Insert(wallpapers []string, wallpaper string) []string {
+	return insertAt(wallpapers, s.rng.IntN(len(wallpapers)+1), wallpaper)
+}
+
+func (s *shuffle) Next(wallpapers []string, accept func(string) bool) int {
+	return first(wallpapers, accept)
+}
+
+func (s *shuffle) Shown(wallpapers []string, i int) {
+	moveToEnd(wallpapers, i)
+}
+
+func (s *shuffle) State([]string) State { return State{} }
+func (s *shuffle) Restore(State)        {}
+
+// reshuffle shows every wallpaper once in a random order, then shuffles them
+// again for the next cycle. The first wallpaper of a cycle is never the last
+// one of the cycle before. The wallpapers shown in the cycle are remembered
+// by path, so wallpapers added or removed part way through and picks limited
+// to some of the wallpapers, such as those of one output, keep the cycle
+// whole; when every wallpaper a pick may choose from has been shown, just
+// those start a new cycle.
+type reshuffle struct {
+	shuffle
+	cycle map[string]bool // wallpapers shown in the current cycle
+}
+
+func (s *reshuffle) Arrange(wallpapers []string) {
+	s.shuffle.Arrange(wallpapers)
+	s.cycle = make(map[string]bool)
+}
+
+func (s *reshuffle) Next(wallpapers []string, accept func(string) bool) int {
+	var allowed []int
+	for i, w := range wallpapers {
+		if !accept(w) {
+			continue
+		}
+		if !s.cycle[w] {
+			return i
+		}
+		allowed = append(allowed, i)
+	}
+	if len(allowed) == 0 {
+		return -1
+	}
+
+	// Every wallpaper allowed has been shown in this cycle. Shown wallpapers
+	// move to the end, so the last one allowed was shown most recently and
+	// must not start the new cycle.
+	last := wallpapers[allowed[len(allowed)-1]]
+	shuffled := make([]string, len(allowed))
+	for j, i := range allowed {
+		shuffled[j] = wallpapers[i]
+		delete(s.cycle, wallpapers[i])
+	}
+	s.rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	if n := len(shuffled); n > 1 && shuffled[0] == last {
+		j := 1 + s.rng.IntN(n-1)
+		shuffled[0], shuffled[j] = shuffled[j], shuffled[0]
+	}
+	for j, i := range allowed {
+		wallpapers[i] = shuffled[j]
+	}
+	return allowed[0]
+}
+
+func (s *reshuffle) Shown(wallpapers []string, i int) {
+	s.cycle[wallpapers[i]] = true
+	moveToEnd(wallpapers, i)
+}
+
+func (s *reshuffle) State(wallpapers []string) State {
+	var cycle []string
+	for _, w := range wallpapers {
+		if s.cycle[w] {
+			cycle = append(cycle, w)
+		}
+	}
+	return State{Cycle: cycle}
+}
+
+func (s *reshuffle) Restore(state State) {
+	s.cycle = make(map[string]bool, len(state.Cycle))
+	for _, w := range state.Cycle {
+		s.cycle[w] = true
+	}
+}
+
+// weighted picks the next wallpaper at random, in proportion to its weight,
+// from the whole list except the wallpaper just shown, so that a wallpaper
+// with ten times the weight is shown about ten times as often but never
+// twice in a row.
+type weighted struct {
+	shuffle
+	weights []Weight
+}
+
+func (s *weighted) Arrange(wallpapers []string) {
+	s.shuffle.Arrange(wallpapers)
+	s.pick(wallpapers, wallpapers)
+}
+
+func (s *weighted) Insert(wallpapers []string, wallpaper string) []string {
+	// behind the wallpaper already picked to be next
+	return insertAt(wallpapers, min(len(wallpapers), 1+s.rng.IntN(len(wallpapers)+1)), wallpaper)
+}
+
+func (s *weighted) Shown(wallpapers []string, i int) {
+	moveToEnd(wallpapers, i)
+	candidates := wallpapers
+	if len(wallpapers) > 1 {
+		// the one just shown, now at the end
+		candidates = wallpapers[:len(wallpapers)-1]
+	}
+	s.pick(wallpapers, candidates)
+}
+
+// Next takes the wallpaper picked to be next if accept allows it, and
+// otherwise draws one by weight from those accept allows. Either way the
+// wallpaper is drawn by weight from those allowed, other than the one shown
+// last.
+func (s *weighted) Next(wallpapers []string, accept func(string) bool) int {
+	if len(wallpapers) > 0 && accept(wallpapers[0]) {
+		return 0
+	}
+	var allowed []string
+	var index []int
+	for i, w := range wallpapers {
+		if accept(w) {
+			allowed = append(allowed, w)
+			index = append(index, i)
+		}
+	}
+	if len(allowed) == 0 {
+		return -1
+	}
+	if len(allowed) > 1 {
+		// shown wallpapers move to the end, so the last one allowed was
+		// shown most recently
+		allowed = allowed[:len(allowed)-1]
+	}
+	return index[s.draw(allowed)]
+}
+
+// pick moves the next wallpaper, chosen by weight from candidates, which
+// start the list, to the front.
+func (s *weighted) pick(wallpapers, candidates []string) {
+	if len(candidates) > 0 {
+		moveToFront(wallpapers, s.draw(candidates))
+	}
+}
+
+// draw returns the index of one of candidates, chosen at random in proportion
+// to their weights.
+func (s *weighted) draw(candidates []string) int {
+	total := 0.0
+	for _, w := range candidates {
+		total += s.weight(w)
+	}
+	r := s.rng.Float64() * total
+	for i, w := range candidates {
+		r -= s.weight(w)
+		if r < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+// weight returns the weight of the most specific entry that covers path: the
+// file itself, or the deepest directory it is in.
+func (s *weighted) weight(path string) float64 {
+	weight, longest := 1.0, -1
+	for _, w := range s.weights {
+		dir := filepath.Clean(w.Path)
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > longest {
+			weight, longest = w.Weight, len(dir)
+		}
+	}
+	return weight
+}
+
+// leastRecent shows the wallpaper that has gone longest without being shown,
+// counting shows rather than time so that a pause or a restart does not
+// change the order. Wallpapers that have never been shown come first, in a
+// random order. The list is kept in the order they were last shown in, so the
+// wallpapers coming up can be prefetched, but each pick looks the oldest one
+// up, so that picks limited to some of the wallpapers, such as those of one
+// output, still take the oldest of those.
+type leastRecent struct {
+	shuffle
+	shown map[string]uint64 // the show each wallpaper was last seen at
+	count uint64            // the number of the last show
+}
+
+func (s *leastRecent) Arrange(wallpapers []string) {
+	s.shuffle.Arrange(wallpapers)
+	slices.SortStableFunc(wallpapers, func(a, b string) int {
+		return cmp.Compare(s.shown[a], s.shown[b])
+	})
+}
+
+func (s *leastRecent) Insert(wallpapers []string, wallpaper string) []string {
+	// after the wallpapers shown before it or at the same time
+	seen := s.shown[wallpaper]
+	i, _ := slices.BinarySearchFunc(wallpapers, seen+1, func(w string, next uint64) int {
+		return cmp.Compare(s.shown[w], next)
+	})
+	if seen == 0 {
+		// among those never shown, at random
+		i = s.rng.IntN(i + 1)
+	}
+	return insertAt(wallpapers, i, wallpaper)
+}
+
+func (s *leastRecent) Next(wallpapers []string, accept func(string) bool) int {
+	oldest := -1
+	for i, w := range wallpapers {
+		if accept(w) && (oldest < 0 || s.shown[w] < s.shown[wallpapers[oldest]]) {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+func (s *leastRecent) Shown(wallpapers []string, i int) {
+	s.count++
+	s.shown[wallpapers[i]] = s.count
+	moveToEnd(wallpapers, i)
+}
+
+func (s *leastRecent) State(wallpapers []string) State {
+	shown := make(map[string]uint64)
+	for _, w := range wallpapers {
+		if n, ok := s.shown[w]; ok {
+			shown[w] = n
+		}
+	}
+	return State{Shown: shown}
+}
+
+func (s *leastRecent) Restore(state State) {
+	s.shown = make(map[string]uint64, len(state.Shown))
+	maps.Copy(s.shown, state.Shown)
+	s.count = 0
+	for _, n := range s.shown {
+		s.count = max(s.count, n)
+	}
+}
@@ -0,0 +1,350 @@
+package selection
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+func newStrategy(t *testing.T, name types.Selection, weights []Weight, seed uint64) Strategy {
+	t.Helper()
+	s, err := New(name, weights, rand.New(rand.NewPCG(seed, seed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// show picks the next wallpaper as the manager does and returns it.
+func show(t *testing.T, s Strategy, wallpapers []string, accept func(string) bool) string {
+	t.Helper()
+	i := s.Next(wallpapers, accept)
+	if i < 0 {
+		t.Fatal("no wallpaper to show")
+	}
+	w := wallpapers[i]
+	s.Shown(wallpapers, i)
+	return w
+}
+
+func all(string) bool { return true }
+
+// only accepts the given wallpapers.
+func only(wallpapers ...string) func(string) bool {
+	return func(w string) bool { return slices.Contains(wallpapers, w) }
+}
+
+func list(n int) []string {
+	wallpapers := make([]string, n)
+	for i := range wallpapers {
+		wallpapers[i] = fmt.Sprintf("/w/%c.png", 'a'+i)
+	}
+	return wallpapers
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name  types.Selection
+		check func(t *testing.T, shown []string)
+	}{
+		{types.SelectionSequential, func(t *testing.T, shown []string) {
+			want := append(list(5), list(5)...)
+			if !slices.Equal(shown, want) {
+				t.Errorf("shown %v, want %v", shown, want)
+			}
+		}},
+		{types.SelectionShuffle, func(t *testing.T, shown []string) {
+			// the same shuffled order, over and over
+			isPermutation(t, shown[:5])
+			if !slices.Equal(shown[:5], shown[5:]) {
+				t.Errorf("the second cycle %v differs from the first %v", shown[5:], shown[:5])
+			}
+		}},
+		{types.SelectionReshuffle, func(t *testing.T, shown []string) {
+			isPermutation(t, shown[:5])
+			isPermutation(t, shown[5:])
+		}},
+		{types.SelectionLeastRecent, func(t *testing.T, shown []string) {
+			// every wallpaper once, then again in the order they were shown
+			isPermutation(t, shown[:5])
+			if !slices.Equal(shown[:5], shown[5:]) {
+				t.Errorf("the second cycle %v differs from the first %v", shown[5:], shown[:5])
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.name), func(t *testing.T) {
+			var runs [2][]string
+			for run := range runs {
+				s := newStrategy(t, tt.name, nil, 42)
+				wallpapers := list(5)
+				s.Arrange(wallpapers)
+				for range 10 {
+					runs[run] = append(runs[run], show(t, s, wallpapers, all))
+				}
+			}
+			if !slices.Equal(runs[0], runs[1]) {
+				t.Errorf("the same seed gave %v and %v", runs[0], runs[1])
+			}
+			tt.check(t, runs[0])
+		})
+	}
+}
+
+// isPermutation checks that shown holds every wallpaper of a list once.
+func isPermutation(t *testing.T, shown []string) {
+	t.Helper()
+	sorted := slices.Sorted(slices.Values(shown))
+	if !slices.Equal(sorted, list(len(shown))) {
+		t.Errorf("%v does not show every wallpaper once", shown)
+	}
+}
+
+func TestReshuffleCycles(t *testing.T) {
+	for seed := range uint64(50) {
+		s := newStrategy(t, types.SelectionReshuffle, nil, seed)
+		wallpapers := list(4)
+		s.Arrange(wallpapers)
+
+		prev := ""
+		for cycle := range 20 {
+			shown := make([]string, 4)
+			for i := range shown {
+				shown[i] = show(t, s, wallpapers, all)
+			}
+			isPermutation(t, shown)
+			if shown[0] == prev {
+				t.Fatalf("seed %d: cycle %d starts with %v, which ended the one before", seed, cycle, prev)
+			}
+			prev = shown[3]
+		}
+	}
+}
+
+func TestReshuffleFiltered(t *testing.T) {
+	// two outputs take turns, each showing only its own wallpapers
+	first, second := only("/w/a.png", "/w/b.png", "/w/c.png"), only("/w/d.png", "/w/e.png")
+	for seed := range uint64(50) {
+		s := newStrategy(t, types.SelectionReshuffle, nil, seed)
+		wallpapers := list(5)
+		s.Arrange(wallpapers)
+
+		var shownFirst, shownSecond []string
+		for range 30 {
+			shownFirst = append(shownFirst, show(t, s, wallpapers, first))
+			shownSecond = append(shownSecond, show(t, s, wallpapers, second))
+		}
+		checkCycles(t, seed, shownFirst, 3)
+		checkCycles(t, seed, shownSecond, 2)
+	}
+}
+
+// checkCycles checks that shown is made of cycles of n different wallpapers,
+// and that no wallpaper is shown twice in a row.
+func checkCycles(t *testing.T, seed uint64, shown []string, n int) {
+	t.Helper()
+	for start := 0; start+n <= len(shown); start += n {
+		cycle := slices.Sorted(slices.Values(shown[start : start+n]))
+		if len(slices.Compact(cycle)) != n {
+			t.Fatalf("seed %d: cycle %v repeats a wallpaper", seed, shown[start:start+n])
+		}
+	}
+	for i := 1; i < len(shown); i++ {
+		if shown[i] == shown[i-1] {
+			t.Fatalf("seed %d: %v shown twice in a row in %v", seed, shown[i], shown)
+		}
+	}
+}
+
+func TestReshuffleChanges(t *testing.T) {
+	for seed := range uint64(50) {
+		s := newStrategy(t, types.SelectionReshuffle, nil, seed)
+		wallpapers := list(5)
+		s.Arrange(wallpapers)
+
+		seen := map[string]bool{show(t, s, wallpapers, all): true}
+		seen[show(t, s, wallpapers, all)] = true
+
+		// part way through the cycle a wallpaper not yet shown is removed,
+		// one is added and the strategy is restored after a restart
+		for i, w := range wallpapers {
+			if !seen[w] {
+				wallpapers = slices.Delete(wallpapers, i, i+1)
+				break
+			}
+		}
+		wallpapers = s.Insert(wallpapers, "/w/new.png")
+		state := s.State(wallpapers)
+		s = newStrategy(t, types.SelectionReshuffle, nil, seed+1000)
+		s.Restore(state)
+
+		// the rest of the cycle shows the wallpapers not shown yet
+		for range len(wallpapers) - len(seen) {
+			w := show(t, s, wallpapers, all)
+			if seen[w] {
+				t.Fatalf("seed %d: %v shown twice in one cycle", seed, w)
+			}
+			seen[w] = true
+		}
+		if len(seen) != len(wallpapers) {
+			t.Fatalf("seed %d: the cycle showed %d of %d wallpapers", seed, len(seen), len(wallpapers))
+		}
+	}
+}
+
+func TestLeastRecent(t *testing.T) {
+	s := newStrategy(t, types.SelectionLeastRecent, nil, 1)
+	wallpapers := list(6)
+	s.Arrange(wallpapers)
+
+	var order []string
+	for range 6 {
+		order = append(order, show(t, s, wallpapers, all))
+	}
+
+	// a pick limited to some of the wallpapers takes the oldest of those
+	if got := show(t, s, wallpapers, only(order[3], order[1], order[4])); got != order[1] {
+		t.Errorf("picked %v, want the oldest %v", got, order[1])
+	}
+	if got := show(t, s, wallpapers, only(order[1], order[5])); got != order[5] {
+		t.Errorf("picked %v, want %v, as %v was just shown", got, order[5], order[1])
+	}
+
+	// a new wallpaper has never been shown, so it comes first
+	wallpapers = s.Insert(wallpapers, "/w/new.png")
+	if got := show(t, s, wallpapers, all); got != "/w/new.png" {
+		t.Errorf("picked %v, want the new wallpaper", got)
+	}
+
+	// the order carries on after a restart, whatever order the list is in
+	state := s.State(wallpapers)
+	s = newStrategy(t, types.SelectionLeastRecent, nil, 2)
+	s.Restore(state)
+	slices.Reverse(wallpapers)
+	want := []string{order[0], order[2], order[3], order[4], order[1], order[5], "/w/new.png"}
+	for i, w := range want {
+		if got := show(t, s, wallpapers, all); got != w {
+			t.Errorf("after restoring, pick %d is %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestWeightedPick(t *testing.T) {
+	s := newStrategy(t, types.SelectionWeighted, []Weight{
+		{Path: "/w/a.png", Weight: 10},
+		{Path: "/w/b.png", Weight: 2},
+	}, 7).(*weighted)
+
+	// every wallpaper but the one just shown, h, is picked from: a and b
+	// with weights 10 and 2, and c to g with a weight of 1 each
+	const trials = 100000
+	counts := make(map[string]int)
+	for range trials {
+		wallpapers := list(8)
+		s.pick(wallpapers, wallpapers[:7])
+		counts[wallpapers[0]]++
+	}
+	want := map[string]float64{"/w/a.png": 10.0 / 17, "/w/b.png": 2.0 / 17}
+	for _, w := range []string{"/w/c.png", "/w/d.png", "/w/e.png", "/w/f.png", "/w/g.png"} {
+		want[w] = 1.0 / 17
+	}
+	for w, p := range want {
+		if got := float64(counts[w]) / trials; math.Abs(got-p) > 0.01 {
+			t.Errorf("%v picked %.3f of the time, want %.3f", w, got, p)
+		}
+	}
+	if ratio := float64(counts["/w/a.png"]) / float64(counts["/w/c.png"]); math.Abs(ratio-10) > 1 {
+		t.Errorf("a weight of 10 picked %.1f times as often as a weight of 1, want 10", ratio)
+	}
+	if counts["/w/h.png"] != 0 {
+		t.Errorf("the wallpaper just shown was picked %d times", counts["/w/h.png"])
+	}
+}
+
+func TestWeightedShows(t *testing.T) {
+	s := newStrategy(t, types.SelectionWeighted, []Weight{
+		{Path: "/w/heavy", Weight: 5},
+		{Path: "/w/heavy/light.png", Weight: 0.5},
+	}, 3)
+	wallpapers := []string{
+		"/w/heavy/a.png", "/w/heavy/b.png", "/w/heavy/light.png",
+		"/w/c.png", "/w/d.png", "/w/e.png", "/w/f.png", "/w/g.png",
+	}
+	s.Arrange(wallpapers)
+
+	counts := make(map[string]int)
+	last := ""
+	for range 20000 {
+		w := show(t, s, wallpapers, all)
+		if w == last {
+			t.Fatalf("%v shown twice in a row", w)
+		}
+		counts[w]++
+		last = w
+	}
+
+	// heavier wallpapers are shown more often, the most specific weight
+	// applies, and wallpapers of the same weight are shown about as often
+	heavy := counts["/w/heavy/a.png"]
+	if heavy <= counts["/w/c.png"] || counts["/w/heavy/light.png"] >= counts["/w/c.png"] {
+		t.Errorf("counts %v do not follow the weights", counts)
+	}
+	if d := math.Abs(float64(heavy-counts["/w/heavy/b.png"])) / float64(heavy); d > 0.05 {
+		t.Errorf("wallpapers of the same weight shown %v and %v times", heavy, counts["/w/heavy/b.png"])
+	}
+}
+
+// TestWeightedFiltered checks that the weights still apply when only some
+// of the wallpapers may be shown, such as those of one output.
+func TestWeightedFiltered(t *testing.T) {
+	s := newStrategy(t, types.SelectionWeighted, []Weight{
+		{Path: "/w/a.png", Weight: 10},
+		{Path: "/w/h.png", Weight: 100},
+	}, 11)
+	wallpapers := list(8)
+	s.Arrange(wallpapers)
+	accept := only("/w/a.png", "/w/b.png", "/w/c.png", "/w/d.png")
+
+	const shows = 50000
+	counts := make(map[string]int)
+	last := ""
+	for range shows {
+		w := show(t, s, wallpapers, accept)
+		if !accept(w) {
+			t.Fatalf("%v shown, want only the wallpapers allowed", w)
+		}
+		if w == last {
+			t.Fatalf("%v shown twice in a row", w)
+		}
+		counts[w]++
+		last = w
+	}
+
+	// after any other wallpaper, a is drawn against the two left with a
+	// weight of 1, 10 times in 12, and it is never drawn twice in a row, so
+	// it is shown 10 times in 22
+	want := map[string]float64{"/w/a.png": 10.0 / 22}
+	for _, w := range []string{"/w/b.png", "/w/c.png", "/w/d.png"} {
+		want[w] = 12.0 / 22 / 3
+	}
+	for w, p := range want {
+		if got := float64(counts[w]) / shows; math.Abs(got-p) > 0.01 {
+			t.Errorf("%v shown %.3f of the time, want %.3f", w, got, p)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	if _, err := New("random", nil, rng); err == nil {
+		t.Error("an unknown selection was accepted")
+	}
+	if _, err := New(types.SelectionWeighted, []Weight{{Path: "/w", Weight: 0}}, rng); err == nil {
+		t.Error("a weight of 0 was accepted")
+	}
+}
@@ -0,0 +1,88 @@
+// Package session tells whether the desktop session smoothpaper was started
+// in has ended, so that a daemon left behind after logging out can exit
+// instead of waiting for a display that will never come back.
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// logindSessionDir is where systemd-logind keeps a file for each session
+// while it exists.
+const logindSessionDir = "/run/systemd/sessions"
+
+// Ended reports whether the session has ended, along with the reason. The
+// logind session named by XDG_SESSION_ID has ended once its file is gone or
+// it is closing. Without logind, the end of a session cannot be told apart
+// from the display restarting, and Ended reports false.
+func Ended() (bool, string) {
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" && logindRunning() {
+		state, err := logindState(id)
+		switch {
+		case os.IsNotExist(err):
+			return true, fmt.Sprintf("logind session %v no longer exists", id)
+		case err == nil && state == "closing":
+			return true, fmt.Sprintf("logind session %v is closing", id)
+		}
+	}
+	return false, ""
+}
+
+// SocketGone reports whether the compositor socket named by WAYLAND_DISPLAY
+// is missing, along with its path. The socket also goes away for a moment
+// while the compositor restarts, so it is only a sign that the session has
+// ended if it stays missing.
+func SocketGone() (bool, string) {
+	socket := waylandSocket()
+	if socket == "" {
+		return false, ""
+	}
+	_, err := os.Stat(socket)
+	return os.IsNotExist(err), socket
+}
+
+// logindRunning reports whether systemd-logind, or elogind, keeps track of
+// sessions on this system.
+func logindRunning() bool {
+	info, err := os.Stat(logindSessionDir)
+	return err == nil && info.IsDir()
+}
+
+// logindState returns the STATE of a logind session, such as "active",
+// "online" or "closing".
+func logindState(id string) (string, error) {
+	f, err := os.Open(filepath.Join(logindSessionDir, id))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if state, ok := strings.CutPrefix(s.Text(), "STATE="); ok {
+			return state, nil
+		}
+	}
+	return "", s.Err()
+}
+
+// waylandSocket returns the path of the compositor socket, or an empty string
+// outside of a Wayland session.
+func waylandSocket() string {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		return ""
+	}
+	if filepath.IsAbs(display) {
+		return display
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return ""
+	}
+	return filepath.Join(runtimeDir, display)
+}
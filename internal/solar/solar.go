@@ -0,0 +1,134 @@
+// Package solar works out where the sun is in the sky at a place and time,
+// and when it rises and sets, using the NOAA solar position equations. It
+// needs no network connection and is accurate to about a minute.
+package solar
+
+import (
+	"math"
+	"time"
+)
+
+// Location is a place on Earth, in degrees; north and east are positive.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Event is a moment in the solar day, named by the depression of the sun
+// below the horizon it happens at.
+type Event float64
+
+const (
+	Sunrise Event = 0.833 // the top of the sun crosses the horizon, allowing for refraction
+	Dawn    Event = 6     // civil twilight starts or ends
+)
+
+// sun is the position of the sun on the celestial sphere at a given time.
+type sun struct {
+	declination float64 // radians
+	eqTime      float64 // equation of time, in minutes
+}
+
+func sunAt(t time.Time) sun {
+	// Julian centuries since J2000.0
+	jd := float64(t.Unix())/86400 + 2440587.5
+	T := (jd - 2451545) / 36525
+
+	L0 := math.Mod(280.46646+T*(36000.76983+T*0.0003032), 360)
+	M := 357.52911 + T*(35999.05029-0.0001537*T)
+	e := 0.016708634 - T*(0.000042037+0.0000001267*T)
+	C := sin(M)*(1.914602-T*(0.004817+0.000014*T)) + sin(2*M)*(0.019993-0.000101*T) + sin(3*M)*0.000289
+	omega := 125.04 - 1934.136*T
+	lambda := L0 + C - 0.00569 - 0.00478*sin(omega)
+	obliquity := 23 + (26+(21.448-T*(46.815+T*(0.00059-T*0.001813)))/60)/60 + 0.00256*cos(omega)
+
+	y := math.Pow(math.Tan(rad(obliquity)/2), 2)
+	eqTime := y*sin(2*L0) - 2*e*sin(M) + 4*e*y*sin(M)*cos(2*L0) - 0.5*y*y*sin(4*L0) - 1.25*e*e*sin(2*M)
+
+	return sun{
+		declination: math.Asin(sin(obliquity) * sin(lambda)),
+		eqTime:      4 * deg(eqTime),
+	}
+}
+
+// hourAngle returns the sun's hour angle at t in degrees, from -180 at solar
+// midnight through 0 at solar noon to 180.
+func (s sun) hourAngle(t time.Time, loc Location) float64 {
+	u := t.UTC()
+	minutes := float64(u.Hour()*60+u.Minute()) + float64(u.Second())/60
+	h := math.Mod((minutes+s.eqTime+4*loc.Longitude)/4, 360) - 180
+	if h < -180 {
+		h += 360
+	}
+	return h
+}
+
+// Elevation returns the angle of the sun above the horizon at t in degrees,
+// negative while it is below.
+func Elevation(t time.Time, loc Location) float64 {
+	s := sunAt(t)
+	lat := rad(loc.Latitude)
+	h := rad(s.hourAngle(t, loc))
+	cosZenith := math.Sin(lat)*math.Sin(s.declination) + math.Cos(lat)*math.Cos(s.declination)*math.Cos(h)
+	return 90 - deg(math.Acos(clamp(cosZenith, -1, 1)))
+}
+
+// Phase returns how far through the solar day t is, judged by the sun's
+// elevation: 0 at solar midnight, when the sun is lowest, 0.5 at solar noon,
+// when it is highest, and back towards 1 as it sinks. Unlike the time of day,
+// the same phase finds the sun at the same height all year round.
+func Phase(t time.Time, loc Location) float64 {
+	s := sunAt(t)
+	lat := rad(loc.Latitude)
+	highest := 90 - deg(math.Abs(lat-s.declination))
+	lowest := deg(math.Abs(lat+s.declination)) - 90
+	if highest-lowest < 1e-6 {
+		return 0
+	}
+	p := clamp((Elevation(t, loc)-lowest)/(highest-lowest), 0, 1) / 2
+	if s.hourAngle(t, loc) >= 0 {
+		// the sun is sinking
+		p = 1 - p
+	}
+	return math.Mod(p, 1)
+}
+
+// Times returns when the sun passes the given event on the day of t, in the
+// morning and in the evening, as minutes since midnight in t's time zone.
+// If the sun stays above that point all day, rise is 0 and set is 24 hours;
+// if it stays below, rise is 24 hours and set is 0.
+func Times(t time.Time, loc Location, event Event) (rise, set time.Duration) {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	// the sun's position around solar noon in UTC on that date, with the
+	// longitude moving noon earlier in the east
+	utcMidnight := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	s := sunAt(utcMidnight.Add(time.Duration((720 - 4*loc.Longitude) * float64(time.Minute))))
+	noon := 720 - 4*loc.Longitude - s.eqTime
+
+	lat := rad(loc.Latitude)
+	cosH := math.Cos(rad(90+float64(event)))/(math.Cos(lat)*math.Cos(s.declination)) - math.Tan(lat)*math.Tan(s.declination)
+	switch {
+	case cosH < -1:
+		return 0, 24 * time.Hour
+	case cosH > 1:
+		return 24 * time.Hour, 0
+	}
+	half := 4 * deg(math.Acos(cosH))
+
+	at := func(minutes float64) time.Duration {
+		abs := utcMidnight.Add(time.Duration(minutes * float64(time.Minute)))
+		return min(max(abs.Sub(midnight), 0), 24*time.Hour)
+	}
+	return at(noon - half), at(noon + half)
+}
+
+func rad(d float64) float64 { return d * math.Pi / 180 }
+func deg(r float64) float64 { return r * 180 / math.Pi }
+func sin(d float64) float64 { return math.Sin(rad(d)) }
+func cos(d float64) float64 { return math.Cos(rad(d)) }
+
+func clamp(v, lo, hi float64) float64 {
+	return min(max(v, lo), hi)
+}
@@ -0,0 +1,107 @@
+package solar
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	london = Location{Latitude: 51.5074, Longitude: -0.1278}
+	tromso = Location{Latitude: 69.6492, Longitude: 18.9553}
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2025, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func hm(hour, minute int) time.Duration {
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// TestTimes checks sunrise and sunset against published times, in UTC, to
+// within a couple of minutes.
+func TestTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		at        time.Time
+		loc       Location
+		event     Event
+		rise, set time.Duration
+	}{
+		{"london equinox", day(time.March, 20), london, Sunrise, hm(6, 2), hm(18, 13)},
+		{"london summer solstice", day(time.June, 21), london, Sunrise, hm(3, 43), hm(20, 21)},
+		{"london winter solstice", day(time.December, 21), london, Sunrise, hm(8, 4), hm(15, 53)},
+		{"london dawn on the equinox", day(time.March, 20), london, Dawn, hm(5, 29), hm(18, 47)},
+		{"tromso polar day", day(time.June, 21), tromso, Sunrise, 0, 24 * time.Hour},
+		{"tromso polar night", day(time.December, 21), tromso, Sunrise, 24 * time.Hour, 0},
+		{"tromso twilight in the polar night", day(time.December, 21), tromso, Dawn, hm(8, 31), hm(12, 53)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rise, set := Times(tt.at, tt.loc, tt.event)
+			if (rise-tt.rise).Abs() > 2*time.Minute || (set-tt.set).Abs() > 2*time.Minute {
+				t.Errorf("Times() = %v, %v, want %v, %v", rise, set, tt.rise, tt.set)
+			}
+		})
+	}
+}
+
+func TestTimesInTimeZone(t *testing.T) {
+	bst := time.FixedZone("BST", 3600)
+	rise, set := Times(time.Date(2025, time.June, 21, 0, 0, 0, 0, bst), london, Sunrise)
+	if (rise-hm(4, 43)).Abs() > 2*time.Minute || (set-hm(21, 21)).Abs() > 2*time.Minute {
+		t.Errorf("Times() = %v, %v, want about 4h43m and 21h21m", rise, set)
+	}
+}
+
+// TestElevation checks the height of the sun at solar noon and midnight,
+// which is 90° less the distance between the latitude and the sun's
+// declination.
+func TestElevation(t *testing.T) {
+	tests := []struct {
+		name string
+		at   time.Time
+		loc  Location
+		want float64
+	}{
+		{"london noon on the equinox", day(time.March, 20).Add(hm(12, 8)), london, 38.5},
+		{"london noon on the summer solstice", day(time.June, 21).Add(hm(12, 2)), london, 61.9},
+		{"london noon on the winter solstice", day(time.December, 21).Add(hm(11, 59)), london, 15.1},
+		{"london midnight on the summer solstice", day(time.June, 21).Add(hm(0, 2)), london, -15.1},
+		{"tromso midnight sun", day(time.June, 21).Add(hm(22, 44)), tromso, 3.1},
+		{"tromso noon in the polar night", day(time.December, 21).Add(hm(10, 44)), tromso, -3.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Elevation(tt.at, tt.loc); math.Abs(got-tt.want) > 0.2 {
+				t.Errorf("Elevation() = %.2f, want %.1f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPhase checks the phase of the solar day against the times of solar
+// midnight, sunrise, solar noon and sunset. Phases just before solar
+// midnight are close to 1, so they are compared around the circle.
+func TestPhase(t *testing.T) {
+	tests := []struct {
+		name string
+		at   time.Time
+		loc  Location
+		want float64
+	}{
+		{"solar midnight", day(time.March, 20).Add(hm(0, 8)), london, 0},
+		{"sunrise", day(time.March, 20).Add(hm(6, 2)), london, 0.25},
+		{"solar noon", day(time.March, 20).Add(hm(12, 8)), london, 0.5},
+		{"sunset", day(time.March, 20).Add(hm(18, 13)), london, 0.75},
+		{"polar night", day(time.December, 21).Add(hm(10, 44)), tromso, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Phase(tt.at, tt.loc); math.Abs(math.Remainder(got-tt.want, 1)) > 0.01 {
+				t.Errorf("Phase() = %.3f, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package transition
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+// Shader is a transition drawn by a fragment shader in the GL Transitions
+// format (https://gl-transitions.com). The source defines
+//
+//	vec4 transition(vec2 uv)
+//
+// which returns the color at uv, from (0, 0) at the bottom left of the output
+// to (1, 1) at the top right, using getFromColor(uv), getToColor(uv), the
+// progress from 0 to 1 and the ratio of the output's width to its height.
+// Uniforms may give a default value in a comment, as in
+//
+//	uniform float smoothness; // = 0.1
+type Shader struct {
+	Name   string
+	Source string
+}
+
+//go:embed shaders/*.glsl
+var builtinShaders embed.FS
+
+// shaders holds the shader transitions by name, the built in ones first and
+// then those loaded with LoadShaders, which may replace them.
+var shaders = make(map[string]Shader)
+
+func init() {
+	entries, _ := builtinShaders.ReadDir("shaders")
+	for _, entry := range entries {
+		src, err := builtinShaders.ReadFile("shaders/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		name := strings.TrimSuffix(entry.Name(), ".glsl")
+		shaders[name] = Shader{Name: name, Source: string(src)}
+	}
+}
+
+// LoadShaders adds every *.glsl file in dir as a shader transition named
+// after the file. A missing directory is not an error. Files that cannot be
+// used are reported and skipped, and the rest are still loaded.
+func LoadShaders(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.glsl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []string
+	var errs []error
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !strings.Contains(string(src), "transition(") {
+			errs = append(errs, fmt.Errorf("%v does not define vec4 transition(vec2 uv)", path))
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".glsl")
+		shaders[name] = Shader{Name: name, Source: string(src)}
+		loaded = append(loaded, name)
+	}
+	return loaded, errors.Join(errs...)
+}
+
+// Lookup returns the shader transition named t, if there is one.
+func Lookup(t types.Transition) (Shader, bool) {
+	s, ok := shaders[string(t)]
+	return s, ok
+}
+
+// ShaderNames returns the names of the shader transitions, sorted.
+func ShaderNames() []string {
+	return slices.Sorted(maps.Keys(shaders))
+}
+
+// uniformDefault matches a uniform declaration with a default value in a
+// comment after it.
+var uniformDefault = regexp.MustCompile(`(?m)^[ \t]*uniform[ \t]+(\w+)[ \t]+(\w+)[ \t]*;[ \t]*//[ \t]*=[ \t]*([^;\n]+?)[ \t]*;?[ \t]*$`)
+
+// integer matches an integer literal, which GLSL does not turn into a float.
+var integer = regexp.MustCompile(`^-?\d+$`)
+
+// FragmentSource returns the complete fragment shader for s. The captured
+// images of the outgoing and incoming wallpapers are bound to the from and to
+// samplers, and cover a capture sized area of the window; the output is the
+// size area at origin within it, all in pixels. Uniforms with a default value
+// become variables set to it, as nothing else sets them. For OpenGL ES, es
+// adds the precision statements it requires.
+func FragmentSource(s Shader, es bool) string {
+	body := uniformDefault.ReplaceAllStringFunc(s.Source, func(decl string) string {
+		m := uniformDefault.FindStringSubmatch(decl)
+		typ, name, value := m[1], m[2], m[3]
+		if typ == "float" && integer.MatchString(value) {
+			value += ".0"
+		}
+		return fmt.Sprintf("%v %v = %v;", typ, name, value)
+	})
+
+	var b strings.Builder
+	if es {
+		// pixel coordinates need more precision than mediump promises
+		b.WriteString("#ifdef GL_FRAGMENT_PRECISION_HIGH\nprecision highp float;\n#else\nprecision mediump float;\n#endif\n")
+	}
+	b.WriteString(`uniform sampler2D from;
+uniform sampler2D to;
+uniform float progress;
+uniform float ratio;
+uniform vec2 u_origin;
+uniform vec2 u_size;
+uniform vec2 u_capture;
+
+vec2 captured(vec2 uv) {
+    return (u_origin + clamp(uv, 0.0, 1.0) * u_size) / u_capture;
+}
+vec4 getFromColor(vec2 uv) {
+    return texture2D(from, captured(uv));
+}
+vec4 getToColor(vec2 uv) {
+    return texture2D(to, captured(uv));
+}
+`)
+	b.WriteString("#line 1\n")
+	b.WriteString(body)
+	b.WriteString(`
+void main() {
+    gl_FragColor = transition((gl_FragCoord.xy - u_origin) / u_size);
+}
+`)
+	return b.String()
+}
@@ -0,0 +1,11 @@
+// Reveals the next wallpaper through a circle growing from the center.
+
+uniform vec2 center; // = vec2(0.5, 0.5)
+uniform float smoothness; // = 0.02
+
+vec4 transition(vec2 uv) {
+    vec2 d = (uv - center) * vec2(ratio, 1.0);
+    float radius = progress * length(vec2(max(center.x, 1.0 - center.x) * ratio, max(center.y, 1.0 - center.y)));
+    float m = smoothstep(radius - smoothness, radius + smoothness, length(d));
+    return mix(getToColor(uv), getFromColor(uv), m);
+}
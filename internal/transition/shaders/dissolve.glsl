@@ -0,0 +1,14 @@
+// Dissolves to the next wallpaper through random noise.
+
+uniform float smoothness; // = 0.1
+
+float noise(vec2 co) {
+    return fract(sin(dot(co, vec2(12.9898, 78.233))) * 43758.5453);
+}
+
+vec4 transition(vec2 uv) {
+    float n = noise(floor(uv * vec2(ratio, 1.0) * 400.0));
+    float p = mix(-smoothness, 1.0 + smoothness, progress);
+    float m = smoothstep(p - smoothness, p + smoothness, n);
+    return mix(getToColor(uv), getFromColor(uv), m);
+}
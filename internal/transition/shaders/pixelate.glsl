@@ -0,0 +1,11 @@
+// Breaks the wallpaper up into ever larger squares, then sharpens the next one.
+
+uniform float squares; // = 50.0
+
+vec4 transition(vec2 uv) {
+    float d = min(progress, 1.0 - progress);
+    float size = max(1.0, d * 2.0 * squares);
+    vec2 cells = vec2(ratio, 1.0) * squares / size;
+    vec2 p = d > 0.0 ? (floor(uv * cells) + 0.5) / cells : uv;
+    return mix(getFromColor(p), getToColor(p), progress);
+}
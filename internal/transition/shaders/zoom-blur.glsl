@@ -0,0 +1,18 @@
+// Zooms into the wallpaper with a radial blur and out of the next one.
+
+uniform float strength; // = 0.4
+
+const float SAMPLES = 20.0;
+
+vec4 transition(vec2 uv) {
+    vec2 center = vec2(0.5, 0.5);
+    float blur = strength * sin(progress * 3.14159265);
+    vec4 a = vec4(0.0);
+    vec4 b = vec4(0.0);
+    for (float i = 0.0; i < SAMPLES; i += 1.0) {
+        vec2 p = mix(uv, center, blur * i / SAMPLES);
+        a += getFromColor(p);
+        b += getToColor(p);
+    }
+    return mix(a, b, smoothstep(0.2, 0.8, progress)) / SAMPLES;
+}
@@ -0,0 +1,133 @@
+// Package transition works out where the outgoing and incoming wallpapers are
+// drawn during each kind of transition, so that every renderer animates them
+// the same way.
+package transition
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/matjam/smoothpaper/internal/types"
+)
+
+// All lists the transitions the renderers draw themselves. Random picks from
+// these and the shader transitions.
+var All = []types.Transition{
+	types.TransitionFade,
+	types.TransitionSlideLeft,
+	types.TransitionSlideRight,
+	types.TransitionSlideUp,
+	types.TransitionSlideDown,
+	types.TransitionPushLeft,
+	types.TransitionPushRight,
+	types.TransitionPushUp,
+	types.TransitionPushDown,
+	types.TransitionWipeLeft,
+	types.TransitionWipeRight,
+	types.TransitionWipeUp,
+	types.TransitionWipeDown,
+}
+
+// Known reports whether t is a transition the renderers can draw, a shader
+// transition, or random.
+func Known(t types.Transition) bool {
+	_, shader := Lookup(t)
+	return t == types.TransitionRandom || shader || slices.Contains(All, t)
+}
+
+// Pick returns the transition to use for the next change: t itself, or when
+// t is random, any transition other than previous.
+func Pick(t, previous types.Transition) types.Transition {
+	if t != types.TransitionRandom {
+		return t
+	}
+	choices := slices.Clone(All)
+	for _, name := range ShaderNames() {
+		choices = append(choices, types.Transition(name))
+	}
+	choices = slices.DeleteFunc(choices, func(c types.Transition) bool {
+		return c == previous
+	})
+	return choices[rand.IntN(len(choices))]
+}
+
+// Rect is a part of an output, in fractions of its size with the origin at
+// the bottom left as in OpenGL.
+type Rect struct {
+	X0, Y0, X1, Y1 float32
+}
+
+// Full is the whole of an output.
+var Full = Rect{0, 0, 1, 1}
+
+// Pixels returns the rectangle in pixels on an output of the given size, as
+// the x, y, width and height glScissor takes.
+func (r Rect) Pixels(width, height int) (int32, int32, int32, int32) {
+	x0, y0 := int32(r.X0*float32(width)), int32(r.Y0*float32(height))
+	x1, y1 := int32(r.X1*float32(width)), int32(r.Y1*float32(height))
+	return x0, y0, x1 - x0, y1 - y0
+}
+
+// Frame describes one frame of a transition. Offsets are in fractions of the
+// output, with x to the right and y upwards.
+type Frame struct {
+	Fade   bool       // the incoming image is blended over the outgoing one, with the progress as its opacity
+	Shader bool       // the transition is drawn by its shader, see Lookup
+	From   [2]float32 // offset of the outgoing image
+	To     [2]float32 // offset of the incoming image
+	Clip   Rect       // part of the output the incoming image is drawn in
+}
+
+// At returns the frame of transition t at the given progress, which runs from
+// 0 to 1 and has already been eased. Slides move the incoming image in over
+// the outgoing one, pushes move both images together, and wipes uncover the
+// incoming image without moving either.
+func At(t types.Transition, progress float32) Frame {
+	f := Frame{Clip: Full}
+	if _, ok := Lookup(t); ok {
+		f.Shader = true
+		return f
+	}
+
+	kind, dir, _ := strings.Cut(string(t), "-")
+	dx, dy := direction(dir)
+	rest := 1 - progress
+
+	switch kind {
+	case "slide":
+		f.To = [2]float32{-dx * rest, -dy * rest}
+	case "push":
+		f.From = [2]float32{dx * progress, dy * progress}
+		f.To = [2]float32{-dx * rest, -dy * rest}
+	case "wipe":
+		switch {
+		case dx < 0:
+			f.Clip.X0 = rest
+		case dx > 0:
+			f.Clip.X1 = progress
+		case dy > 0:
+			f.Clip.Y1 = progress
+		case dy < 0:
+			f.Clip.Y0 = rest
+		}
+	default:
+		f.Fade = true
+	}
+	return f
+}
+
+// direction returns the unit vector the images move in, with y upwards.
+func direction(dir string) (float32, float32) {
+	switch dir {
+	case "left":
+		return -1, 0
+	case "right":
+		return 1, 0
+	case "up":
+		return 0, 1
+	case "down":
+		return 0, -1
+	}
+	return 0, 0
+}
@@ -7,6 +7,11 @@ const (
 	ScalingModeStretch       ScalingMode = "stretched"
 	ScalingModeFitHorizontal ScalingMode = "horizontal"
 	ScalingModeFitVertical   ScalingMode = "vertical"
+	ScalingModeSpan          ScalingMode = "span"
+	ScalingModeFill          ScalingMode = "fill"
+	ScalingModeFit           ScalingMode = "fit"
+	ScalingModeTile          ScalingMode = "tile"
+	ScalingModeFitBlur       ScalingMode = "fit-blur"
 )
 
 type EasingMode string
@@ -17,3 +22,47 @@ const (
 	EasingEaseOut   EasingMode = "ease-out"
 	EasingEaseInOut EasingMode = "ease-in-out"
 )
+
+type OutputMode string
+
+const (
+	OutputModeSame        OutputMode = "same"
+	OutputModeIndependent OutputMode = "independent"
+	OutputModeStaggered   OutputMode = "staggered"
+)
+
+type Transition string
+
+const (
+	TransitionFade       Transition = "fade"
+	TransitionSlideLeft  Transition = "slide-left"
+	TransitionSlideRight Transition = "slide-right"
+	TransitionSlideUp    Transition = "slide-up"
+	TransitionSlideDown  Transition = "slide-down"
+	TransitionPushLeft   Transition = "push-left"
+	TransitionPushRight  Transition = "push-right"
+	TransitionPushUp     Transition = "push-up"
+	TransitionPushDown   Transition = "push-down"
+	TransitionWipeLeft   Transition = "wipe-left"
+	TransitionWipeRight  Transition = "wipe-right"
+	TransitionWipeUp     Transition = "wipe-up"
+	TransitionWipeDown   Transition = "wipe-down"
+	TransitionRandom     Transition = "random"
+)
+
+type DisconnectPolicy string
+
+const (
+	DisconnectReconnect DisconnectPolicy = "reconnect"
+	DisconnectExit      DisconnectPolicy = "exit"
+)
+
+type Selection string
+
+const (
+	SelectionSequential  Selection = "sequential"
+	SelectionShuffle     Selection = "shuffle"
+	SelectionReshuffle   Selection = "reshuffle"
+	SelectionWeighted    Selection = "weighted"
+	SelectionLeastRecent Selection = "least-recent"
+)
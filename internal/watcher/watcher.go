@@ -0,0 +1,192 @@
+// Package watcher keeps the wallpaper list in sync with the wallpaper
+// directories by watching them with inotify.
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/matjam/smoothpaper/internal/scanner"
+)
+
+// Watcher reports wallpapers that are added to or removed from the watched
+// directories. New files are only reported once they have not been written to
+// for the debounce period, so images that are still being copied are not
+// picked up half written.
+type Watcher struct {
+	fsw      *fsnotify.Watcher
+	scanner  *scanner.Scanner
+	roots    []string
+	debounce time.Duration
+
+	pending map[string]time.Time // files waiting for writes to settle, by last event time
+	removed map[string]bool      // paths removed since the last flush
+}
+
+// New creates a watcher over the given wallpaper directories, using the
+// scanner to decide which files and subdirectories are of interest. dirs are
+// the directories the scanner visited below the roots, as returned by
+// ScanTree, which are watched without scanning them again.
+func New(s *scanner.Scanner, debounce time.Duration, roots, dirs []string) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		fsw:      fsw,
+		scanner:  s,
+		roots:    roots,
+		debounce: debounce,
+		pending:  make(map[string]time.Time),
+		removed:  make(map[string]bool),
+	}
+
+	w.watchDirs(dirs)
+	return w, nil
+}
+
+// Run processes filesystem events until the watcher is closed. added and
+// removed are called from Run's goroutine with batches of paths; a removed
+// path may be a directory, in which case everything below it is gone.
+func (w *Watcher) Run(added, removed func([]string)) {
+	ticker := time.NewTicker(w.debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("Wallpaper watcher error: %v", err)
+		case now := <-ticker.C:
+			if paths := w.flushRemoved(); len(paths) > 0 {
+				removed(paths)
+			}
+			if paths := w.flushPending(now); len(paths) > 0 {
+				added(paths)
+			}
+		}
+	}
+}
+
+// Close stops watching and makes Run return.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	log.Debugf("Wallpaper watcher event: %v", event)
+
+	switch {
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		delete(w.pending, event.Name)
+		w.removed[event.Name] = true
+
+	case event.Has(fsnotify.Create):
+		delete(w.removed, event.Name)
+		info, err := os.Lstat(event.Name)
+		if err != nil {
+			return
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.scanner.Options().FollowSymlinks {
+				return
+			}
+			if info, err = os.Stat(event.Name); err != nil {
+				return
+			}
+		}
+		if info.IsDir() {
+			w.addDir(event.Name)
+			return
+		}
+		w.pending[event.Name] = time.Now()
+
+	case event.Has(fsnotify.Write):
+		w.pending[event.Name] = time.Now()
+	}
+}
+
+// addDir starts watching a directory that appeared under a root and queues
+// any files that were moved in along with it.
+func (w *Watcher) addDir(dir string) {
+	root := w.rootOf(dir)
+	if root == "" || !w.scanner.AcceptDir(root, dir) {
+		return
+	}
+	files, dirs, err := w.scanner.ScanDir(root, dir)
+	if err != nil {
+		log.Warnf("Failed to scan new directory %v: %v", dir, err)
+		return
+	}
+	w.watchDirs(dirs)
+	now := time.Now()
+	for _, file := range files {
+		w.pending[file] = now
+	}
+}
+
+func (w *Watcher) watchDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := w.fsw.Add(dir); err != nil {
+			log.Warnf("Failed to watch %v: %v", dir, err)
+			continue
+		}
+		log.Debugf("Watching %v", dir)
+	}
+}
+
+// flushPending returns the files that have not changed for the debounce
+// period and are still wallpapers.
+func (w *Watcher) flushPending(now time.Time) []string {
+	var ready []string
+	for path, last := range w.pending {
+		if now.Sub(last) < w.debounce {
+			continue
+		}
+		delete(w.pending, path)
+
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		root := w.rootOf(path)
+		if root == "" || !w.scanner.Accept(root, path) {
+			continue
+		}
+		ready = append(ready, path)
+	}
+	return ready
+}
+
+func (w *Watcher) flushRemoved() []string {
+	var paths []string
+	for path := range w.removed {
+		paths = append(paths, path)
+	}
+	clear(w.removed)
+	return paths
+}
+
+// rootOf returns the watched wallpaper directory that contains path, or an
+// empty string if there is none.
+func (w *Watcher) rootOf(path string) string {
+	root := ""
+	for _, r := range w.roots {
+		if (path == r || strings.HasPrefix(path, r+string(filepath.Separator))) && len(r) > len(root) {
+			root = r
+		}
+	}
+	return root
+}
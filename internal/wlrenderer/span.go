@@ -0,0 +1,65 @@
+package wlrenderer
+
+import "slices"
+
+// spanView is the part of the combined output layout that one output shows,
+// in fractions of the layout, along with the aspect ratio of the layout.
+type spanView struct {
+	x, y, w, h float32
+	aspect     float32
+}
+
+// spanLayout places every configured output in one layout using their
+// positions in the compositor, and returns the part each output shows along
+// with the size of the layout in logical pixels. The span gap is added
+// between neighbouring columns and rows of outputs, so that the part of the
+// image hidden behind the monitor bezels is skipped and lines crossing from
+// one monitor to the next stay straight.
+func (r *WLRenderer) spanLayout() (map[uint32]spanView, int, int) {
+	var xs, ys []int
+	for _, out := range r.outputs {
+		if out.width > 0 && out.height > 0 {
+			xs = append(xs, out.x)
+			ys = append(ys, out.y)
+		}
+	}
+	if len(xs) == 0 {
+		return nil, 0, 0
+	}
+	slices.Sort(xs)
+	slices.Sort(ys)
+	xs = slices.Compact(xs)
+	ys = slices.Compact(ys)
+
+	type rect struct{ x, y, w, h int }
+	rects := make(map[uint32]rect, len(r.outputs))
+	width, height := 0, 0
+	for id, out := range r.outputs {
+		if out.width <= 0 || out.height <= 0 {
+			continue
+		}
+		col, _ := slices.BinarySearch(xs, out.x)
+		row, _ := slices.BinarySearch(ys, out.y)
+		rc := rect{
+			x: out.x - xs[0] + col*r.spanGap,
+			y: out.y - ys[0] + row*r.spanGap,
+			w: out.width,
+			h: out.height,
+		}
+		rects[id] = rc
+		width = max(width, rc.x+rc.w)
+		height = max(height, rc.y+rc.h)
+	}
+
+	views := make(map[uint32]spanView, len(rects))
+	for id, rc := range rects {
+		views[id] = spanView{
+			x:      float32(rc.x) / float32(width),
+			y:      float32(rc.y) / float32(height),
+			w:      float32(rc.w) / float32(width),
+			h:      float32(rc.h) / float32(height),
+			aspect: float32(width) / float32(height),
+		}
+	}
+	return views, width, height
+}
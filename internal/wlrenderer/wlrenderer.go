@@ -9,29 +9,50 @@ extern const struct wl_interface wl_output_interface;
 import "C"
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"runtime"
 	"runtime/cgo"
+	"slices"
 	"time"
 	"unsafe"
 
 	"github.com/charmbracelet/log"
+	"github.com/matjam/smoothpaper/internal/atlas"
+	"github.com/matjam/smoothpaper/internal/imageformat"
+	"github.com/matjam/smoothpaper/internal/kenburns"
+	"github.com/matjam/smoothpaper/internal/quad"
+	"github.com/matjam/smoothpaper/internal/resample"
+	"github.com/matjam/smoothpaper/internal/transition"
 	"github.com/matjam/smoothpaper/internal/types"
 )
 
 type texture struct {
 	id            C.GLuint
 	width, height int
+	motion        kenburns.Motion // the pan and zoom across the image while it is shown
+	backdrop      C.GLuint        // a blurred copy drawn behind the image by the fit-blur scale mode, or 0
+	atlas         *atlas.Atlas    // the frames of an animated image, which the texture holds, or nil
 }
 
 type WLRenderer struct {
 	width      int
 	height     int
 	scaleMode  types.ScalingMode
+	letterbox  color.RGBA // the color of the bars around images that do not fill the output
 	easingMode types.EasingMode
+	transition types.Transition // the configured transition, which may be random
+	kenBurns   kenburns.Config  // how images pan and zoom while they are shown
 	framerate  int
+	spanGap    int  // logical pixels hidden between neighbouring outputs when spanning
+	outputBlur bool // whether an output's own scale mode is fit-blur, so every texture needs a backdrop
+
+	minFrameDelay time.Duration // the shortest time a frame of an animated image is shown, capping its frame rate
+
+	lastTransition types.Transition // the transition used for the last change
 
 	// Wayland core
 	display    *C.struct_wl_display
@@ -40,6 +61,8 @@ type WLRenderer struct {
 	layerSurf  *C.struct_zwlr_layer_surface_v1
 	layerShell *C.struct_zwlr_layer_shell_v1
 	compositor *C.struct_wl_compositor
+	// optional; tells us the names and logical positions of the outputs
+	xdgOutputManager *C.struct_zxdg_output_manager_v1
 	// protocol version negotiated when binding wl_compositor
 	compositorVersion int
 
@@ -49,19 +72,16 @@ type WLRenderer struct {
 	eglSurface C.EGLSurface // kept for backward compatibility, unused in multi-output path
 	eglConfig  C.EGLConfig
 
-	currentTex    texture
-	transitionTex texture
-	blackTex      texture
-
-	start    time.Time
-	duration time.Duration
-	fading   bool
+	currentTex   texture // the image last shown on every output, given to outputs that appear later
+	letterboxTex texture
+	textureRefs  map[C.GLuint]int // how many holders each texture has; textures can be shared between outputs
 
 	shaderProgram C.GLuint
 	attribPos     C.GLint
 	attribTex     C.GLint
 	uniformTex    C.GLint
 	uniformAlpha  C.GLint
+	uniformOffset C.GLint
 
 	registryHandle cgo.Handle
 
@@ -76,6 +96,13 @@ type WLRenderer struct {
 
 	// Per-output
 	outputs map[uint32]*outputSurface
+
+	maxTextureSize int // GL_MAX_TEXTURE_SIZE, the largest texture the GPU accepts
+
+	outputScaleModes map[string]types.ScalingMode // scale modes that override scaleMode, by output name
+	outputPeriods    map[string]time.Duration     // how long the pan and zoom of the next image shown on each output lasts, by output name
+
+	transitionPrograms map[types.Transition]*transitionProgram // compiled shader transitions; nil if one failed to compile
 }
 
 type outputSurface struct {
@@ -89,20 +116,64 @@ type outputSurface struct {
 	width      int
 	height     int
 	scale      int
+	x, y       int // position in the compositor's global layout
 	configChan chan struct{}
+
+	xdgOutput       *C.struct_zxdg_output_v1
+	name            string // name given by the compositor, such as "DP-1"
+	description     string // human readable description given by the compositor
+	logicalPosition bool   // whether x and y came from xdg-output, which takes precedence
+
+	// each output shows its own image and fades on its own
+	currentTex    texture
+	transitionTex texture
+	start         time.Time
+	duration      time.Duration
+	fading        bool
+	transition    types.Transition // how the output changes to transitionTex
+
+	// the output as it looked with each image, for shader transitions
+	fromCapture texture
+	toCapture   texture
+}
+
+// Name returns the name the output is addressed by. Compositors without
+// xdg-output do not name their outputs, so they are numbered instead.
+func (o *outputSurface) Name() string {
+	if o.name != "" {
+		return o.name
+	}
+	return fmt.Sprintf("output-%d", o.id)
 }
 
 // removed per-output helpers (not used in single-surface reconnect strategy)
 
-func NewRenderer(scale types.ScalingMode, easing types.EasingMode, framerate int) (*WLRenderer, error) {
+// NewRenderer connects to the compositor and creates a surface on every
+// output. outputBlur says whether any output will be given the fit-blur scale
+// mode of its own, so that textures uploaded before that output appears have
+// the blurred backdrop it draws.
+func NewRenderer(scale types.ScalingMode, letterbox color.RGBA, easing types.EasingMode, trans types.Transition, kb kenburns.Config, framerate int, animationFramerate int, spanGap int, outputBlur bool) (*WLRenderer, error) {
 	runtime.LockOSThread() // Required: OpenGL contexts must be accessed from a single OS thread
 
 	r := &WLRenderer{
-		scaleMode:  scale,
-		easingMode: easing,
-		framerate:  framerate,
-		configChan: make(chan struct{}, 1),
-		outputs:    make(map[uint32]*outputSurface),
+		scaleMode:   scale,
+		letterbox:   letterbox,
+		easingMode:  easing,
+		transition:  trans,
+		kenBurns:    kb,
+		framerate:   framerate,
+		spanGap:     spanGap,
+		outputBlur:  outputBlur,
+		configChan:  make(chan struct{}, 1),
+		outputs:     make(map[uint32]*outputSurface),
+		textureRefs: make(map[C.GLuint]int),
+
+		outputScaleModes:   make(map[string]types.ScalingMode),
+		outputPeriods:      make(map[string]time.Duration),
+		transitionPrograms: make(map[types.Transition]*transitionProgram),
+	}
+	if animationFramerate > 0 {
+		r.minFrameDelay = time.Second / time.Duration(animationFramerate)
 	}
 
 	if err := r.connectToDisplay(); err != nil {
@@ -137,6 +208,17 @@ func goHandleGlobal(handle C.uintptr_t, registry *C.struct_wl_registry, name C.u
 		r.compositor = (*C.struct_wl_compositor)(C.wl_registry_bind(registry, name, &C.wl_compositor_interface, want))
 		r.compositorVersion = int(want)
 		log.Debug("bound wl_compositor")
+	case "zxdg_output_manager_v1":
+		// output names were added in v2
+		want := C.uint32_t(3)
+		if version < want {
+			want = version
+		}
+		r.xdgOutputManager = (*C.struct_zxdg_output_manager_v1)(C.wl_registry_bind(registry, name, &C.zxdg_output_manager_v1_interface, want))
+		log.Debug("bound zxdg_output_manager_v1")
+		for _, out := range r.outputs {
+			r.bindXdgOutput(out)
+		}
 	case "wl_output":
 		// Bind and track this output (we need scale event which exists since v2)
 		want := C.uint32_t(3)
@@ -146,9 +228,10 @@ func goHandleGlobal(handle C.uintptr_t, registry *C.struct_wl_registry, name C.u
 		wlOut := (*C.struct_wl_output)(C.wl_registry_bind(registry, name, &C.wl_output_interface, want))
 		id := uint32(name)
 		if _, exists := r.outputs[id]; !exists {
-			out := &outputSurface{id: id, output: wlOut, configChan: make(chan struct{}, 1), scale: 1}
+			out := &outputSurface{id: id, output: wlOut, configChan: make(chan struct{}, 1), scale: 1, currentTex: r.retain(r.currentTex)}
 			r.outputs[id] = out
 			C.wl_output_add_listener(wlOut, C.get_output_listener(), unsafe.Pointer(uintptr(r.registryHandle)))
+			r.bindXdgOutput(out)
 			log.Debugf("bound wl_output id=%d", id)
 			if r.initialized {
 				r.outputsDirty = true
@@ -170,6 +253,8 @@ func goHandleGlobalRemove(handle C.uintptr_t, _ *C.struct_wl_registry, name C.ui
 	id := uint32(name)
 	if out, ok := r.outputs[id]; ok {
 		// Destroy and drop this output
+		r.releaseOutputTextures(out)
+		destroyXdgOutput(out)
 		if out.eglSurface != nil && r.eglDisplay != 0 {
 			C.eglDestroySurface(r.eglDisplay, out.eglSurface)
 			out.eglSurface = nil
@@ -275,6 +360,100 @@ func goHandleOutputScale(handle C.uintptr_t, output *C.struct_wl_output, factor
 	}
 }
 
+//export goHandleOutputGeometry
+func goHandleOutputGeometry(handle C.uintptr_t, output *C.struct_wl_output, x, y C.int32_t) {
+	h := cgo.Handle(uintptr(handle))
+	r := h.Value().(*WLRenderer)
+	if r == nil {
+		log.Error("goHandleOutputGeometry: nil renderer")
+		return
+	}
+	for _, out := range r.outputs {
+		if out.output == output {
+			if !out.logicalPosition {
+				out.x = int(x)
+				out.y = int(y)
+			}
+			break
+		}
+	}
+}
+
+// bindXdgOutput asks the compositor for the name and logical position of an
+// output, if it supports xdg-output.
+func (r *WLRenderer) bindXdgOutput(out *outputSurface) {
+	if r.xdgOutputManager == nil || out.xdgOutput != nil {
+		return
+	}
+	out.xdgOutput = C.zxdg_output_manager_v1_get_xdg_output(r.xdgOutputManager, out.output)
+	if out.xdgOutput == nil {
+		log.Warnf("failed to get xdg output for output id=%d", out.id)
+		return
+	}
+	C.zxdg_output_v1_add_listener(out.xdgOutput, C.get_xdg_output_listener(), unsafe.Pointer(uintptr(r.registryHandle)))
+}
+
+// destroyXdgOutput releases the xdg output of an output that is going away.
+func destroyXdgOutput(out *outputSurface) {
+	if out.xdgOutput != nil {
+		C.zxdg_output_v1_destroy(out.xdgOutput)
+		out.xdgOutput = nil
+	}
+}
+
+// outputForXdgOutput returns the output the xdg output describes, or nil.
+func (r *WLRenderer) outputForXdgOutput(xdgOutput *C.struct_zxdg_output_v1) *outputSurface {
+	for _, out := range r.outputs {
+		if out.xdgOutput == xdgOutput {
+			return out
+		}
+	}
+	return nil
+}
+
+//export goHandleXdgOutputLogicalPosition
+func goHandleXdgOutputLogicalPosition(handle C.uintptr_t, xdgOutput *C.struct_zxdg_output_v1, x, y C.int32_t) {
+	h := cgo.Handle(uintptr(handle))
+	r := h.Value().(*WLRenderer)
+	if r == nil {
+		log.Error("goHandleXdgOutputLogicalPosition: nil renderer")
+		return
+	}
+	if out := r.outputForXdgOutput(xdgOutput); out != nil {
+		out.x = int(x)
+		out.y = int(y)
+		out.logicalPosition = true
+	}
+}
+
+//export goHandleXdgOutputName
+func goHandleXdgOutputName(handle C.uintptr_t, xdgOutput *C.struct_zxdg_output_v1, name *C.char) {
+	h := cgo.Handle(uintptr(handle))
+	r := h.Value().(*WLRenderer)
+	if r == nil {
+		log.Error("goHandleXdgOutputName: nil renderer")
+		return
+	}
+	if out := r.outputForXdgOutput(xdgOutput); out != nil {
+		out.name = C.GoString(name)
+		log.Debugf("output id=%d is named %v", out.id, out.name)
+	}
+}
+
+//export goHandleXdgOutputDescription
+func goHandleXdgOutputDescription(handle C.uintptr_t, xdgOutput *C.struct_zxdg_output_v1, description *C.char) {
+	h := cgo.Handle(uintptr(handle))
+	r := h.Value().(*WLRenderer)
+	if r == nil {
+		log.Error("goHandleXdgOutputDescription: nil renderer")
+		return
+	}
+	if out := r.outputForXdgOutput(xdgOutput); out != nil {
+		out.description = C.GoString(description)
+		log.Debugf("output %v is %v", out.Name(), out.description)
+	}
+}
+
 //export goHandleLayerSurfaceClosed
 func goHandleLayerSurfaceClosed(handle C.uintptr_t, surf *C.struct_zwlr_layer_surface_v1) {
 	log.Debugf("goHandleLayerSurfaceClosed: handle=%d", handle)
@@ -290,6 +469,8 @@ func goHandleLayerSurfaceClosed(handle C.uintptr_t, surf *C.struct_zwlr_layer_su
 	// If this belongs to any output, destroy just that output
 	for id, out := range r.outputs {
 		if out.layerSurf == surf {
+			r.releaseOutputTextures(out)
+			destroyXdgOutput(out)
 			if out.eglSurface != nil && r.eglDisplay != 0 {
 				C.eglDestroySurface(r.eglDisplay, out.eglSurface)
 				out.eglSurface = nil
@@ -492,7 +673,14 @@ func (r *WLRenderer) connectToDisplay() error {
 			return fmt.Errorf("failed to make EGL context current for output")
 		}
 		if r.shaderProgram == 0 {
-			r.setupShaderProgram()
+			if err := r.setupShaderProgram(); err != nil {
+				return err
+			}
+		}
+		if r.maxTextureSize == 0 {
+			var maxTextureSize C.GLint
+			C.glGetIntegerv(C.GL_MAX_TEXTURE_SIZE, &maxTextureSize)
+			r.maxTextureSize = int(maxTextureSize)
 		}
 	}
 
@@ -503,7 +691,7 @@ func (r *WLRenderer) connectToDisplay() error {
 }
 
 // setupShaderProgram creates and configures the GL shader program
-func (r *WLRenderer) setupShaderProgram() {
+func (r *WLRenderer) setupShaderProgram() error {
 	posStr := C.CString("a_position")
 	defer C.free(unsafe.Pointer(posStr))
 	texCoordStr := C.CString("a_texCoord")
@@ -512,105 +700,136 @@ func (r *WLRenderer) setupShaderProgram() {
 	defer C.free(unsafe.Pointer(texStr))
 	alphaStr := C.CString("u_alpha")
 	defer C.free(unsafe.Pointer(alphaStr))
+	offsetStr := C.CString("u_offset")
+	defer C.free(unsafe.Pointer(offsetStr))
 
 	// Create shader program
-	prog := compileProgram(vertexShaderSrc, fragmentShaderSrc)
+	prog, err := compileProgram(vertexShaderSrc, fragmentShaderSrc)
+	if err != nil {
+		return err
+	}
 	r.shaderProgram = prog
 	r.attribPos = C.GLint(C.glGetAttribLocation(prog, posStr))
 	r.attribTex = C.GLint(C.glGetAttribLocation(prog, texCoordStr))
 	r.uniformTex = C.GLint(C.glGetUniformLocation(prog, texStr))
 	r.uniformAlpha = C.GLint(C.glGetUniformLocation(prog, alphaStr))
+	r.uniformOffset = C.GLint(C.glGetUniformLocation(prog, offsetStr))
+	return nil
 }
 
-func (r *WLRenderer) SetImage(img image.Image) error {
-	// Delete previous texture
-	if r.currentTex.id != 0 {
-		C.glDeleteTextures(1, &r.currentTex.id)
-		r.currentTex = texture{}
+// limitSize scales img down if it is larger than the GPU accepts in a texture.
+func (r *WLRenderer) limitSize(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := resample.Limit(b.Dx(), b.Dy(), r.maxTextureSize)
+	if w == b.Dx() && h == b.Dy() {
+		return img
 	}
+	log.Warnf("image is %vx%v, scaling to %vx%v to fit the maximum texture size", b.Dx(), b.Dy(), w, h)
+	return resample.Scale(img, w, h)
+}
 
-	// Convert image to RGBA if not already
-	rgba, ok := img.(*image.RGBA)
-	if !ok {
-		tmp := image.NewRGBA(img.Bounds())
-		draw.Draw(tmp, tmp.Bounds(), img, image.Point{}, draw.Src)
-		rgba = tmp
+// SetImage shows img on every output immediately.
+func (r *WLRenderer) SetImage(img image.Image) error {
+	tex, err := r.newTexture(img)
+	if err != nil {
+		return fmt.Errorf("failed to upload image: %w", err)
 	}
 
-	// Generate texture
-	var tex C.GLuint
-	C.glGenTextures(1, &tex)
-	C.glBindTexture(C.GL_TEXTURE_2D, tex)
-
-	// Set texture parameters
-	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_WRAP_S, C.GL_CLAMP_TO_EDGE)
-	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_WRAP_T, C.GL_CLAMP_TO_EDGE)
-	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_MIN_FILTER, C.GL_LINEAR)
-	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_MAG_FILTER, C.GL_LINEAR)
+	r.release(&r.currentTex)
+	r.currentTex = r.retain(tex)
+	for _, out := range r.outputs {
+		r.releaseOutputTextures(out)
+		out.currentTex = r.retain(tex)
+	}
+	return nil
+}
 
-	// Upload pixels
-	b := rgba.Bounds()
-	width := b.Dx()
-	height := b.Dy()
-	C.glTexImage2D(
-		C.GL_TEXTURE_2D,
-		0,
-		C.GL_RGBA,
-		C.GLsizei(width),
-		C.GLsizei(height),
-		0,
-		C.GL_RGBA,
-		C.GL_UNSIGNED_BYTE,
-		unsafe.Pointer(&rgba.Pix[0]),
-	)
+// SetOutputImage shows img on the named output immediately.
+func (r *WLRenderer) SetOutputImage(name string, img image.Image) error {
+	out := r.outputByName(name)
+	if out == nil {
+		return fmt.Errorf("no output named %v", name)
+	}
 
-	r.currentTex.id = tex
-	r.currentTex.width = width
-	r.currentTex.height = height
+	tex, err := r.newTexture(img)
+	if err != nil {
+		return fmt.Errorf("failed to upload image: %w", err)
+	}
+	tex.motion.Period = r.motionPeriodFor(name)
 
-	r.fading = false // this is a static set, no transition yet
+	r.releaseOutputTextures(out)
+	out.currentTex = r.retain(tex)
 	return nil
 }
 
+// Transition fades every output to next, blocking until the fade is done.
 func (r *WLRenderer) Transition(next image.Image, duration time.Duration) error {
-	// If no blackTex, create a black texture
-	if r.blackTex.id == 0 {
-		blackTex, err := r.createColorTexture(0, 0, 0)
-		if err != nil {
-			return fmt.Errorf("failed to create black transition texture: %w", err)
-		}
-		r.blackTex = blackTex
+	tex, err := r.newTexture(next)
+	if err != nil {
+		return fmt.Errorf("failed to upload transition image: %w", err)
 	}
 
-	// If no currentTex, fade from black
-	if r.currentTex.id == 0 {
-		blackTex, err := r.createColorTexture(0, 0, 0)
+	r.release(&r.currentTex)
+	r.currentTex = r.retain(tex)
+	kind := r.nextTransition()
+	for _, out := range r.outputs {
+		r.startFade(out, tex, duration, kind)
+	}
+	return r.runTransitions()
+}
+
+// TransitionOutputs fades each named output to its own image, over the
+// duration given for that output, blocking until the fades are done. Outputs
+// not named keep their current image.
+func (r *WLRenderer) TransitionOutputs(images map[string]image.Image, durations map[string]time.Duration) error {
+	kind := r.nextTransition()
+	for name, img := range images {
+		out := r.outputByName(name)
+		if out == nil {
+			log.Warnf("Output %v went away, not changing its wallpaper", name)
+			continue
+		}
+		tex, err := r.newTexture(img)
 		if err != nil {
-			return fmt.Errorf("failed to create black fallback texture: %w", err)
+			return fmt.Errorf("failed to upload transition image for %v: %w", name, err)
 		}
-		r.currentTex = blackTex
+		tex.motion.Period = r.motionPeriodFor(name)
+		r.startFade(out, tex, durations[name], kind)
 	}
+	return r.runTransitions()
+}
 
-	// Delete old transitionTex if it exists
-	if r.transitionTex.id != 0 {
-		C.glDeleteTextures(1, &r.transitionTex.id)
-		r.transitionTex = texture{}
-	}
+// nextTransition returns the transition to use for the next change, picking
+// a different one each time when the configured transition is random.
+func (r *WLRenderer) nextTransition() types.Transition {
+	r.lastTransition = transition.Pick(r.transition, r.lastTransition)
+	return r.lastTransition
+}
 
-	// Upload next image to transitionTex
-	tex, err := r.uploadImageToTexture(next)
-	if err != nil {
-		return fmt.Errorf("failed to upload transition image: %w", err)
+// startFade starts the output's transition from its current image to tex.
+func (r *WLRenderer) startFade(out *outputSurface, tex texture, duration time.Duration, kind types.Transition) {
+	r.release(&out.transitionTex)
+	out.transitionTex = r.retain(tex)
+	out.start = time.Now()
+	out.duration = duration
+	out.fading = true
+	out.transition = kind
+	deleteCaptures(out)
+}
+
+// runTransitions renders frames until no output is fading any more.
+func (r *WLRenderer) runTransitions() error {
+	// If no letterboxTex, create one in the letterbox color
+	if r.letterboxTex.id == 0 {
+		letterboxTex, err := r.createColorTexture(r.letterbox.R, r.letterbox.G, r.letterbox.B)
+		if err != nil {
+			return fmt.Errorf("failed to create letterbox texture: %w", err)
+		}
+		r.letterboxTex = letterboxTex
 	}
-	r.transitionTex.id = tex
-	r.transitionTex.width = next.Bounds().Dx()
-	r.transitionTex.height = next.Bounds().Dy()
-	r.start = time.Now()
-	r.duration = duration
-	r.fading = true
 
 	// Frame loop
-	for r.fading {
+	for r.fading() {
 		if !r.IsDisplayRunning() {
 			log.Info("Display connection lost, returning to main loop")
 			return fmt.Errorf("display connection lost in transition")
@@ -624,6 +843,187 @@ func (r *WLRenderer) Transition(next image.Image, duration time.Duration) error
 	return nil
 }
 
+// fading reports whether any output is in the middle of a fade.
+func (r *WLRenderer) fading() bool {
+	for _, out := range r.outputs {
+		if out.fading {
+			return true
+		}
+	}
+	return false
+}
+
+// fadeAlpha returns the opacity of the image the output is fading to, and
+// finishes the fade once its time is up.
+func (r *WLRenderer) fadeAlpha(out *outputSurface) float32 {
+	if !out.fading {
+		return 1.0
+	}
+	progress := float32(time.Since(out.start).Seconds() / out.duration.Seconds())
+	if progress < 1.0 {
+		return applyEasing(r.easingMode, progress)
+	}
+
+	r.release(&out.currentTex)
+	out.currentTex = out.transitionTex
+	out.transitionTex = texture{}
+	out.fading = false
+	deleteCaptures(out)
+	return 1.0
+}
+
+// Animating reports whether what is shown moves between changes, panning and
+// zooming or playing an animated image, so Render must be called every frame.
+func (r *WLRenderer) Animating() bool {
+	if r.kenBurns.Enabled {
+		return true
+	}
+	for _, out := range r.outputs {
+		if out.currentTex.atlas != nil || out.transitionTex.atlas != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOutputScaleMode makes the named output scale images with mode instead
+// of the renderer's scale mode, or with the renderer's again if mode is
+// empty. It also applies if the output is connected later.
+func (r *WLRenderer) SetOutputScaleMode(name string, mode types.ScalingMode) {
+	r.outputScaleModes[name] = mode
+}
+
+// SetMotionPeriod sets how long the pan and zoom of the images shown on every
+// output from now on lasts.
+func (r *WLRenderer) SetMotionPeriod(period time.Duration) {
+	r.kenBurns.Period = period
+}
+
+// SetOutputMotionPeriod sets how long the pan and zoom of the images shown
+// next on the named output alone lasts.
+func (r *WLRenderer) SetOutputMotionPeriod(name string, period time.Duration) {
+	r.outputPeriods[name] = period
+}
+
+// motionPeriodFor returns how long the pan and zoom of the next image shown
+// on the named output alone lasts.
+func (r *WLRenderer) motionPeriodFor(name string) time.Duration {
+	if period, ok := r.outputPeriods[name]; ok {
+		return period
+	}
+	return r.kenBurns.Period
+}
+
+// scaleModeFor returns the scale mode the output draws with. Spanning
+// applies to every output, so it cannot be overridden.
+func (r *WLRenderer) scaleModeFor(out *outputSurface) types.ScalingMode {
+	if mode := r.outputScaleModes[out.Name()]; mode != "" && r.scaleMode != types.ScalingModeSpan {
+		return mode
+	}
+	return r.scaleMode
+}
+
+// outputByName returns the output with the given name, or nil.
+func (r *WLRenderer) outputByName(name string) *outputSurface {
+	for _, out := range r.outputs {
+		if out.Name() == name {
+			return out
+		}
+	}
+	return nil
+}
+
+// Outputs returns the names of the outputs, sorted.
+func (r *WLRenderer) Outputs() []string {
+	names := make([]string, 0, len(r.outputs))
+	for _, out := range r.outputs {
+		names = append(names, out.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+// newTexture uploads img to a texture that nothing holds yet. Its pan and
+// zoom, and its animation if it has one, start now.
+func (r *WLRenderer) newTexture(img image.Image) (texture, error) {
+	var sheet *atlas.Atlas
+	upload := img
+	if anim, ok := img.(*imageformat.Animation); ok {
+		// every frame goes into the one texture
+		sheet = atlas.Pack(anim, r.maxTextureSize, r.minFrameDelay)
+		upload = sheet.Image
+	} else {
+		upload = r.limitSize(img)
+	}
+	id, err := r.uploadImageToTexture(upload)
+	if err != nil {
+		return texture{}, err
+	}
+	tex := texture{id: id, width: upload.Bounds().Dx(), height: upload.Bounds().Dy(), motion: r.kenBurns.Start()}
+	if sheet != nil {
+		tex.width, tex.height = sheet.FrameWidth, sheet.FrameHeight
+		tex.atlas = sheet
+	}
+	if r.usesBackdrop() {
+		if tex.backdrop, err = r.uploadImageToTexture(resample.Backdrop(img, backdropSize)); err != nil {
+			C.glDeleteTextures(1, &tex.id)
+			return texture{}, err
+		}
+	}
+	return tex, nil
+}
+
+// backdropSize is the longest side of the blurred copy of an image drawn
+// behind it by the fit-blur scale mode. The smaller it is, the blurrier.
+const backdropSize = 48
+
+// usesBackdrop reports whether any output draws, or may later draw, with the
+// fit-blur scale mode.
+func (r *WLRenderer) usesBackdrop() bool {
+	if r.scaleMode == types.ScalingModeFitBlur || r.outputBlur {
+		return true
+	}
+	for _, mode := range r.outputScaleModes {
+		if mode == types.ScalingModeFitBlur {
+			return true
+		}
+	}
+	return false
+}
+
+// retain records another holder of t and returns it.
+func (r *WLRenderer) retain(t texture) texture {
+	if t.id != 0 {
+		r.textureRefs[t.id]++
+	}
+	return t
+}
+
+// release drops a holder of *t and clears it, deleting the texture once no
+// output shows it any more.
+func (r *WLRenderer) release(t *texture) {
+	if t.id == 0 {
+		return
+	}
+	r.textureRefs[t.id]--
+	if r.textureRefs[t.id] <= 0 {
+		delete(r.textureRefs, t.id)
+		C.glDeleteTextures(1, &t.id)
+		if t.backdrop != 0 {
+			C.glDeleteTextures(1, &t.backdrop)
+		}
+	}
+	*t = texture{}
+}
+
+// releaseOutputTextures drops the images an output holds and ends its fade.
+func (r *WLRenderer) releaseOutputTextures(out *outputSurface) {
+	r.release(&out.currentTex)
+	r.release(&out.transitionTex)
+	deleteCaptures(out)
+	out.fading = false
+}
+
 func applyEasing(mode types.EasingMode, t float32) float32 {
 	switch mode {
 	case types.EasingLinear:
@@ -689,28 +1089,17 @@ func (r *WLRenderer) Render() error {
 		}
 	}
 
-	// Calculate alpha
-	alpha := float32(1.0)
-	if r.fading {
-		elapsed := time.Since(r.start)
-		progress := float32(elapsed.Seconds() / r.duration.Seconds())
-		if progress >= 1.0 {
-			progress = 1.0
-			oldTexture := r.currentTex
-			r.currentTex = r.transitionTex
-			r.transitionTex = texture{}
-			r.fading = false
-			alpha = 1.0
-			if oldTexture.id != 0 {
-				C.glDeleteTextures(1, &oldTexture.id)
-			}
-		} else {
-			alpha = applyEasing(r.easingMode, progress)
-		}
+	var spans map[uint32]spanView
+	if r.scaleMode == types.ScalingModeSpan {
+		spans, _, _ = r.spanLayout()
 	}
 
 	anyRendered := false
 	for _, out := range r.outputs {
+		// fades progress even on outputs that cannot be drawn right now
+		alpha := r.fadeAlpha(out)
+		span := spans[out.id]
+		scaleMode := r.scaleModeFor(out)
 		if !out.configured || out.eglSurface == nil {
 			continue
 		}
@@ -719,42 +1108,55 @@ func (r *WLRenderer) Render() error {
 			return fmt.Errorf("failed to make EGL context current for output")
 		}
 		if r.shaderProgram == 0 {
-			r.setupShaderProgram()
+			if err := r.setupShaderProgram(); err != nil {
+				return err
+			}
 		}
 		// Ensure viewport matches buffer size
 		C.glViewport(0, 0, C.GLsizei(out.width*out.scale), C.GLsizei(out.height*out.scale))
+		C.glClearColor(C.GLfloat(r.letterbox.R)/255, C.GLfloat(r.letterbox.G)/255, C.GLfloat(r.letterbox.B)/255, 1)
 		C.glClear(C.GL_COLOR_BUFFER_BIT)
 		C.glUseProgram(r.shaderProgram)
 
-		if r.fading && r.currentTex.id != 0 {
-			C.glUniform1f(r.uniformAlpha, 1.0)
-			C.glActiveTexture(C.GL_TEXTURE0)
-			C.glBindTexture(C.GL_TEXTURE_2D, r.currentTex.id)
-			C.glUniform1i(r.uniformTex, 0)
-			drawTexturedQuad(out.width, out.height, r.scaleMode, r.attribPos, r.attribTex, C.GLint(r.currentTex.width), C.GLint(r.currentTex.height))
-			C.glEnable(C.GL_BLEND)
-			C.glBlendFunc(C.GL_SRC_ALPHA, C.GL_ONE_MINUS_SRC_ALPHA)
-			if r.blackTex.id != 0 {
-				C.glUniform1f(r.uniformAlpha, C.GLfloat(alpha))
-				C.glActiveTexture(C.GL_TEXTURE0)
-				C.glBindTexture(C.GL_TEXTURE_2D, r.blackTex.id)
-				C.glUniform1i(r.uniformTex, 0)
-				drawTexturedQuad(out.width, out.height, types.ScalingModeStretch, r.attribPos, r.attribTex, C.GLint(out.width), C.GLint(out.height))
+		frame := transition.At(out.transition, alpha)
+		if out.fading && frame.Shader && !r.drawShaderFrame(out, scaleMode, span, alpha) {
+			// the shader did not compile, so this change fades instead
+			out.transition = types.TransitionFade
+			frame = transition.At(out.transition, alpha)
+		}
+
+		if out.fading && frame.Shader {
+			// drawn by the transition's shader
+		} else if out.fading {
+			if out.currentTex.id != 0 {
+				r.drawImage(out, out.currentTex, scaleMode, span, 1.0, frame.From)
 			}
-			if r.transitionTex.id != 0 {
-				C.glUniform1f(r.uniformAlpha, C.GLfloat(alpha))
-				C.glActiveTexture(C.GL_TEXTURE0)
-				C.glBindTexture(C.GL_TEXTURE_2D, r.transitionTex.id)
-				C.glUniform1i(r.uniformTex, 0)
-				drawTexturedQuad(out.width, out.height, r.scaleMode, r.attribPos, r.attribTex, C.GLint(r.transitionTex.width), C.GLint(r.transitionTex.height))
+			if frame.Fade {
+				C.glEnable(C.GL_BLEND)
+				C.glBlendFunc(C.GL_SRC_ALPHA, C.GL_ONE_MINUS_SRC_ALPHA)
+				if r.letterboxTex.id != 0 {
+					r.drawImage(out, r.letterboxTex, types.ScalingModeStretch, spanView{}, alpha, frame.To)
+				}
+				if out.transitionTex.id != 0 {
+					r.drawImage(out, out.transitionTex, scaleMode, span, alpha, frame.To)
+				}
+				C.glDisable(C.GL_BLEND)
+			} else {
+				// the incoming image covers the outgoing one, bars and all,
+				// within the part of the output it has reached
+				x, y, w, h := frame.Clip.Pixels(out.width*out.scale, out.height*out.scale)
+				C.glEnable(C.GL_SCISSOR_TEST)
+				C.glScissor(C.GLint(x), C.GLint(y), C.GLsizei(w), C.GLsizei(h))
+				if r.letterboxTex.id != 0 {
+					r.drawImage(out, r.letterboxTex, types.ScalingModeStretch, spanView{}, 1.0, frame.To)
+				}
+				if out.transitionTex.id != 0 {
+					r.drawImage(out, out.transitionTex, scaleMode, span, 1.0, frame.To)
+				}
+				C.glDisable(C.GL_SCISSOR_TEST)
 			}
-			C.glDisable(C.GL_BLEND)
-		} else if r.currentTex.id != 0 {
-			C.glUniform1f(r.uniformAlpha, 1.0)
-			C.glActiveTexture(C.GL_TEXTURE0)
-			C.glBindTexture(C.GL_TEXTURE_2D, r.currentTex.id)
-			C.glUniform1i(r.uniformTex, 0)
-			drawTexturedQuad(out.width, out.height, r.scaleMode, r.attribPos, r.attribTex, C.GLint(r.currentTex.width), C.GLint(r.currentTex.height))
+		} else if out.currentTex.id != 0 {
+			r.drawImage(out, out.currentTex, scaleMode, span, 1.0, [2]float32{})
 		}
 
 		C.glFinish()
@@ -787,23 +1189,42 @@ func (r *WLRenderer) Render() error {
 	return nil
 }
 
+// GetSize returns the largest buffer size across all outputs, which is the
+// most detail any output can show of an image. When spanning, it is the size
+// of the combined layout instead.
 func (r *WLRenderer) GetSize() (int, int) {
-	return r.width, r.height
+	if r.scaleMode == types.ScalingModeSpan {
+		_, width, height := r.spanLayout()
+		scale := 1
+		for _, out := range r.outputs {
+			scale = max(scale, out.scale)
+		}
+		return width * scale, height * scale
+	}
+
+	width, height := r.width, r.height
+	for _, out := range r.outputs {
+		scale := max(out.scale, 1)
+		width = max(width, out.width*scale)
+		height = max(height, out.height*scale)
+	}
+	return width, height
+}
+
+// MaxTextureSize returns the largest texture width or height the GPU accepts.
+func (r *WLRenderer) MaxTextureSize() int {
+	return r.maxTextureSize
 }
 
 func (r *WLRenderer) Cleanup() {
 	// Delete GL textures
-	if r.currentTex.id != 0 {
-		C.glDeleteTextures(1, &r.currentTex.id)
-		r.currentTex = texture{}
-	}
-	if r.transitionTex.id != 0 {
-		C.glDeleteTextures(1, &r.transitionTex.id)
-		r.transitionTex = texture{}
+	r.release(&r.currentTex)
+	for _, out := range r.outputs {
+		r.releaseOutputTextures(out)
 	}
-	if r.blackTex.id != 0 {
-		C.glDeleteTextures(1, &r.blackTex.id)
-		r.blackTex = texture{}
+	if r.letterboxTex.id != 0 {
+		C.glDeleteTextures(1, &r.letterboxTex.id)
+		r.letterboxTex = texture{}
 	}
 
 	// Delete shader program
@@ -811,9 +1232,16 @@ func (r *WLRenderer) Cleanup() {
 		C.glDeleteProgram(r.shaderProgram)
 		r.shaderProgram = 0
 	}
+	for _, p := range r.transitionPrograms {
+		if p != nil {
+			C.glDeleteProgram(p.program)
+		}
+	}
+	clear(r.transitionPrograms)
 
 	// Destroy per-output resources
 	for id, out := range r.outputs {
+		destroyXdgOutput(out)
 		if out.eglSurface != nil && r.eglDisplay != 0 {
 			C.eglDestroySurface(r.eglDisplay, out.eglSurface)
 			out.eglSurface = nil
@@ -853,6 +1281,11 @@ func (r *WLRenderer) Cleanup() {
 		r.surface = nil
 	}
 
+	if r.xdgOutputManager != nil {
+		C.zxdg_output_manager_v1_destroy(r.xdgOutputManager)
+		r.xdgOutputManager = nil
+	}
+
 	// Disconnect Wayland
 	if r.display != nil {
 		C.wl_display_disconnect(r.display)
@@ -940,20 +1373,31 @@ func (r *WLRenderer) createColorTexture(rVal, gVal, bVal uint8) (texture, error)
 		unsafe.Pointer(&pix[0]),
 	)
 
-	return texture{tex, w, h}, nil
+	return texture{id: tex, width: w, height: h}, nil
 }
 
 const vertexShaderSrc = `
     attribute vec2 a_position;
     attribute vec2 a_texCoord;
+    uniform vec2 u_offset;
     varying vec2 v_texCoord;
 
     void main() {
-        gl_Position = vec4(a_position, 0.0, 1.0);
+        gl_Position = vec4(a_position + u_offset, 0.0, 1.0);
         v_texCoord = a_texCoord;
     }
 `
 
+// transitionVertexShaderSrc is paired with the fragment shader of each shader
+// transition, which works out where it is from gl_FragCoord.
+const transitionVertexShaderSrc = `
+    attribute vec2 a_position;
+
+    void main() {
+        gl_Position = vec4(a_position, 0.0, 1.0);
+    }
+`
+
 const fragmentShaderSrc = `
     precision mediump float;
     varying vec2 v_texCoord;
@@ -966,7 +1410,7 @@ const fragmentShaderSrc = `
     }
 `
 
-func compileShader(src string, shaderType C.GLenum) C.GLuint {
+func compileShader(src string, shaderType C.GLenum) (C.GLuint, error) {
 	csrc := C.CString(src)
 	defer C.free(unsafe.Pointer(csrc))
 
@@ -979,16 +1423,24 @@ func compileShader(src string, shaderType C.GLenum) C.GLuint {
 	if status == C.GL_FALSE {
 		var logLen C.GLint
 		C.glGetShaderiv(shader, C.GL_INFO_LOG_LENGTH, &logLen)
-		log := make([]byte, int(logLen))
+		log := make([]byte, max(int(logLen), 1))
 		C.glGetShaderInfoLog(shader, logLen, nil, (*C.GLchar)(unsafe.Pointer(&log[0])))
-		panic(fmt.Sprintf("shader compile error: %s", log))
+		C.glDeleteShader(shader)
+		return 0, fmt.Errorf("shader compile error: %s", bytes.TrimRight(log, "\x00\n"))
 	}
-	return shader
+	return shader, nil
 }
 
-func compileProgram(vsrc, fsrc string) C.GLuint {
-	vs := compileShader(vsrc, C.GL_VERTEX_SHADER)
-	fs := compileShader(fsrc, C.GL_FRAGMENT_SHADER)
+func compileProgram(vsrc, fsrc string) (C.GLuint, error) {
+	vs, err := compileShader(vsrc, C.GL_VERTEX_SHADER)
+	if err != nil {
+		return 0, err
+	}
+	fs, err := compileShader(fsrc, C.GL_FRAGMENT_SHADER)
+	if err != nil {
+		C.glDeleteShader(vs)
+		return 0, err
+	}
 
 	prog := C.glCreateProgram()
 	C.glAttachShader(prog, vs)
@@ -1000,72 +1452,234 @@ func compileProgram(vsrc, fsrc string) C.GLuint {
 	if status == C.GL_FALSE {
 		var logLen C.GLint
 		C.glGetProgramiv(prog, C.GL_INFO_LOG_LENGTH, &logLen)
-		log := make([]byte, int(logLen))
+		log := make([]byte, max(int(logLen), 1))
 		C.glGetProgramInfoLog(prog, logLen, nil, (*C.GLchar)(unsafe.Pointer(&log[0])))
-		panic(fmt.Sprintf("program link error: %s", log))
+		C.glDeleteShader(vs)
+		C.glDeleteShader(fs)
+		C.glDeleteProgram(prog)
+		return 0, fmt.Errorf("program link error: %s", bytes.TrimRight(log, "\x00\n"))
 	}
 
 	C.glDeleteShader(vs)
 	C.glDeleteShader(fs)
 
-	return prog
+	return prog, nil
 }
 
-func drawTexturedQuad(screenWidth, screenHeight int, scaleMode types.ScalingMode, attribPos, attribTex C.GLint, texWidth, texHeight C.GLint) {
-	// Default to full screen quad
-	var x1, y1, x2, y2 float32 = -1.0, -1.0, 1.0, 1.0
+// transitionProgram is a compiled shader transition.
+type transitionProgram struct {
+	program   C.GLuint
+	attribPos C.GLint
+	from      C.GLint
+	to        C.GLint
+	progress  C.GLint
+	ratio     C.GLint
+	origin    C.GLint
+	size      C.GLint
+	capture   C.GLint
+}
 
-	// Texture coordinates (always use full texture)
-	var u1, v1, u2, v2 float32 = 0.0, 1.0, 1.0, 0.0
+// transitionProgram returns the compiled shader of a shader transition,
+// compiling it the first time. If it does not compile, the error is logged
+// once and nil is returned.
+func (r *WLRenderer) transitionProgram(name types.Transition) *transitionProgram {
+	if p, ok := r.transitionPrograms[name]; ok {
+		return p
+	}
 
-	// Calculate aspect ratios
-	screenAspect := float32(screenWidth) / float32(screenHeight)
-	textureAspect := float32(texWidth) / float32(texHeight)
+	shader, _ := transition.Lookup(name)
+	prog, err := compileProgram(transitionVertexShaderSrc, transition.FragmentSource(shader, true))
+	if err != nil {
+		log.Errorf("Transition %v failed to compile, fading instead: %v", name, err)
+		r.transitionPrograms[name] = nil
+		return nil
+	}
 
-	// Adjust coordinates based on scaling mode
-	switch scaleMode {
-	case types.ScalingModeStretch:
-		// Use full screen coordinates (already set)
+	p := &transitionProgram{
+		program:   prog,
+		attribPos: attribLocation(prog, "a_position"),
+		from:      uniformLocation(prog, "from"),
+		to:        uniformLocation(prog, "to"),
+		progress:  uniformLocation(prog, "progress"),
+		ratio:     uniformLocation(prog, "ratio"),
+		origin:    uniformLocation(prog, "u_origin"),
+		size:      uniformLocation(prog, "u_size"),
+		capture:   uniformLocation(prog, "u_capture"),
+	}
+	r.transitionPrograms[name] = p
+	return p
+}
+
+// attribLocation returns the location of the named attribute in prog.
+func attribLocation(prog C.GLuint, name string) C.GLint {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return C.GLint(C.glGetAttribLocation(prog, cname))
+}
 
-	case types.ScalingModeFitHorizontal:
-		// Keep width at 100%, adjust height to maintain texture aspect ratio
-		scaledHeight := 1.0 / (textureAspect / screenAspect)
-		y1 = -scaledHeight
-		y2 = scaledHeight
+// uniformLocation returns the location of the named uniform in prog.
+func uniformLocation(prog C.GLuint, name string) C.GLint {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return C.GLint(C.glGetUniformLocation(prog, cname))
+}
 
-	case types.ScalingModeFitVertical:
-		// Keep height at 100%, adjust width to maintain texture aspect ratio
-		scaledWidth := textureAspect / screenAspect
-		x1 = -scaledWidth
-		x2 = scaledWidth
+// drawShaderFrame draws a frame of the output's shader transition. The first
+// frame captures the output showing each image, which the shader then blends;
+// while the images pan and zoom or play, every frame captures them again.
+// It returns false if the shader did not compile.
+func (r *WLRenderer) drawShaderFrame(out *outputSurface, scaleMode types.ScalingMode, span spanView, progress float32) bool {
+	p := r.transitionProgram(out.transition)
+	if p == nil {
+		return false
+	}
 
-	case types.ScalingModeCenter:
-		fallthrough
-	default:
-		// "Fill" mode - use the smaller scaling factor to ensure no cropping
-		if textureAspect > screenAspect {
-			// Texture is wider than screen
-			// Fit to width and adjust height
-			scaledHeight := screenAspect / textureAspect
-			y1 = -scaledHeight
-			y2 = scaledHeight
+	w, h := out.width*out.scale, out.height*out.scale
+	if out.fromCapture.id == 0 || r.kenBurns.Enabled || out.currentTex.atlas != nil || out.transitionTex.atlas != nil {
+		deleteCaptures(out)
+		if out.currentTex.id != 0 {
+			r.drawImage(out, out.currentTex, scaleMode, span, 1.0, [2]float32{})
+		}
+		out.fromCapture = captureFramebuffer(w, h)
+		C.glClear(C.GL_COLOR_BUFFER_BIT)
+		if out.transitionTex.id != 0 {
+			r.drawImage(out, out.transitionTex, scaleMode, span, 1.0, [2]float32{})
+		}
+		out.toCapture = captureFramebuffer(w, h)
+		C.glClear(C.GL_COLOR_BUFFER_BIT)
+	}
+
+	C.glUseProgram(p.program)
+	C.glActiveTexture(C.GL_TEXTURE0)
+	C.glBindTexture(C.GL_TEXTURE_2D, out.fromCapture.id)
+	C.glUniform1i(p.from, 0)
+	C.glActiveTexture(C.GL_TEXTURE1)
+	C.glBindTexture(C.GL_TEXTURE_2D, out.toCapture.id)
+	C.glUniform1i(p.to, 1)
+	C.glUniform1f(p.progress, C.GLfloat(progress))
+	C.glUniform1f(p.ratio, C.GLfloat(float32(w)/float32(h)))
+	C.glUniform2f(p.origin, 0, 0)
+	C.glUniform2f(p.size, C.GLfloat(w), C.GLfloat(h))
+	C.glUniform2f(p.capture, C.GLfloat(w), C.GLfloat(h))
+	drawFullQuad(p.attribPos)
+
+	C.glActiveTexture(C.GL_TEXTURE0)
+	C.glUseProgram(r.shaderProgram)
+	return true
+}
+
+// captureFramebuffer copies what has been drawn on the current surface into a
+// new texture.
+func captureFramebuffer(width, height int) texture {
+	var tex C.GLuint
+	C.glGenTextures(1, &tex)
+	C.glBindTexture(C.GL_TEXTURE_2D, tex)
+	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_WRAP_S, C.GL_CLAMP_TO_EDGE)
+	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_WRAP_T, C.GL_CLAMP_TO_EDGE)
+	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_MIN_FILTER, C.GL_LINEAR)
+	C.glTexParameteri(C.GL_TEXTURE_2D, C.GL_TEXTURE_MAG_FILTER, C.GL_LINEAR)
+	// RGB can be copied whether or not the surface has an alpha channel
+	C.glCopyTexImage2D(C.GL_TEXTURE_2D, 0, C.GL_RGB, 0, 0, C.GLsizei(width), C.GLsizei(height), 0)
+	return texture{id: tex, width: width, height: height}
+}
+
+// deleteCaptures deletes the output's captures for a shader transition.
+func deleteCaptures(out *outputSurface) {
+	for _, capture := range []*texture{&out.fromCapture, &out.toCapture} {
+		if capture.id != 0 {
+			C.glDeleteTextures(1, &capture.id)
+			*capture = texture{}
+		}
+	}
+}
+
+// drawFullQuad fills the viewport with a quad that has only positions.
+func drawFullQuad(attribPos C.GLint) {
+	vertices := []float32{-1, -1, 1, -1, -1, 1, 1, 1}
+	C.glEnableVertexAttribArray(C.GLuint(attribPos))
+	C.glVertexAttribPointer(C.GLuint(attribPos), 2, C.GL_FLOAT, C.GL_FALSE, 0, unsafe.Pointer(&vertices[0]))
+	C.glDrawArrays(C.GL_TRIANGLE_STRIP, 0, 4)
+	C.glDisableVertexAttribArray(C.GLuint(attribPos))
+}
+
+// drawImage draws tex on the output at the given opacity, moved by offset in
+// fractions of the output. The fit-blur scale mode draws the blurred copy of
+// the image over the whole output first.
+func (r *WLRenderer) drawImage(out *outputSurface, tex texture, scaleMode types.ScalingMode, span spanView, alpha float32, offset [2]float32) {
+	C.glUniform1f(r.uniformAlpha, C.GLfloat(alpha))
+	// clip space is two units across
+	C.glUniform2f(r.uniformOffset, C.GLfloat(offset[0]*2), C.GLfloat(offset[1]*2))
+	C.glActiveTexture(C.GL_TEXTURE0)
+	C.glUniform1i(r.uniformTex, 0)
+
+	// quads are laid out in buffer pixels, so tiles are drawn pixel for pixel
+	w, h := out.width*out.scale, out.height*out.scale
+	view := tex.motion.View()
+	if scaleMode == types.ScalingModeFitBlur && tex.backdrop != 0 {
+		C.glBindTexture(C.GL_TEXTURE_2D, tex.backdrop)
+		drawTexturedQuad(w, h, types.ScalingModeFill, r.attribPos, r.attribTex, C.GLint(tex.width), C.GLint(tex.height), span, view, nil)
+	}
+	C.glBindTexture(C.GL_TEXTURE_2D, tex.id)
+	drawTexturedQuad(w, h, scaleMode, r.attribPos, r.attribTex, C.GLint(tex.width), C.GLint(tex.height), span, view, tex.atlas)
+}
+
+// drawTexturedQuad draws the bound texture on an output of the given size.
+// When spanning, span is the part of the combined layout the output shows.
+// view is the part of the image its pan and zoom has reached. For an animated
+// image, sheet is the atlas of its frames the texture holds, and the current
+// frame is drawn.
+func drawTexturedQuad(screenWidth, screenHeight int, scaleMode types.ScalingMode, attribPos, attribTex C.GLint, texWidth, texHeight C.GLint, span spanView, view kenburns.View, sheet *atlas.Atlas) {
+	if scaleMode == types.ScalingModeSpan && span.w == 0 {
+		// the output is not part of the layout yet
+		scaleMode = types.ScalingModeCenter
+	}
+
+	var quads []quad.Quad
+	if scaleMode == types.ScalingModeSpan {
+		// The texture covers the whole layout, cropped to the layout's aspect
+		// ratio, and this output shows its part of it
+		textureAspect := float32(texWidth) / float32(texHeight)
+		fw, fh := float32(1.0), float32(1.0)
+		if textureAspect > span.aspect {
+			fw = span.aspect / textureAspect
 		} else {
-			// Texture is taller than screen
-			// Fit to height and adjust width
-			scaledWidth := textureAspect / screenAspect
-			x1 = -scaledWidth
-			x2 = scaledWidth
+			fh = textureAspect / span.aspect
+		}
+		ox, oy := (1-fw)/2, (1-fh)/2
+		// the pan and zoom moves across the whole layout, not each output
+		a1, b1, a2, b2 := view.Crop(ox, oy, ox+fw, oy+fh)
+		quads = []quad.Quad{{
+			X1: -1, Y1: -1, X2: 1, Y2: 1,
+			U1: a1 + span.x*(a2-a1),
+			U2: a1 + (span.x+span.w)*(a2-a1),
+			V1: b1 + (span.y+span.h)*(b2-b1),
+			V2: b1 + span.y*(b2-b1),
+		}}
+	} else {
+		quads = quad.Layout(scaleMode, screenWidth, screenHeight, int(texWidth), int(texHeight))
+		if len(quads) == 1 {
+			q := &quads[0]
+			q.U1, q.V1, q.U2, q.V2 = view.Crop(q.U1, q.V1, q.U2, q.V2)
 		}
 	}
+	if len(quads) == 0 {
+		return
+	}
+	for i := range quads {
+		quads[i] = sheet.Map(quads[i])
+	}
 
 	// Interleaved vertex data: [x, y, u, v]
-	vertices := []float32{
-		x1, y1, u1, v1, // Bottom left
-		x2, y1, u2, v1, // Bottom right
-		x1, y2, u1, v2, // Top left
-		x2, y1, u2, v1, // Bottom right
-		x2, y2, u2, v2, // Top right
-		x1, y2, u1, v2, // Top left
+	vertices := make([]float32, 0, len(quads)*6*4)
+	for _, q := range quads {
+		vertices = append(vertices,
+			q.X1, q.Y1, q.U1, q.V1, // Bottom left
+			q.X2, q.Y1, q.U2, q.V1, // Bottom right
+			q.X1, q.Y2, q.U1, q.V2, // Top left
+			q.X2, q.Y1, q.U2, q.V1, // Bottom right
+			q.X2, q.Y2, q.U2, q.V2, // Top right
+			q.X1, q.Y2, q.U1, q.V2, // Top left
+		)
 	}
 
 	// Set up vertex attribute pointers
@@ -1093,7 +1707,7 @@ func drawTexturedQuad(screenWidth, screenHeight int, scaleMode types.ScalingMode
 	)
 
 	// Draw the triangles
-	C.glDrawArrays(C.GL_TRIANGLES, 0, 6)
+	C.glDrawArrays(C.GL_TRIANGLES, 0, C.GLsizei(len(quads)*6))
 
 	// Disable attribute arrays
 	C.glDisableVertexAttribArray(C.GLuint(attribPos))
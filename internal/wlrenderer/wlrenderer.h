@@ -8,6 +8,7 @@
 #include <wayland-egl.h>
 
 #include "wlr-layer-shell-unstable-v1.h"
+#include "xdg-output-unstable-v1.h"
 #include "xdg-shell-protocol.h"
 
 // Forward-declare the Go handler
@@ -65,12 +66,13 @@ extern const struct wl_interface wl_output_interface;
 
 // ===== wl_output listener for scale/geometry =====
 extern void goHandleOutputScale(uintptr_t handle, struct wl_output *output, int32_t factor);
+extern void goHandleOutputGeometry(uintptr_t handle, struct wl_output *output, int32_t x, int32_t y);
 
 static void shimHandleOutputGeometry(void *data, struct wl_output *output, int32_t x, int32_t y,
                                     int32_t phys_width, int32_t phys_height, int32_t subpixel,
                                     const char *make, const char *model, int32_t transform) {
-    (void)data; (void)output; (void)x; (void)y; (void)phys_width; (void)phys_height;
-    (void)subpixel; (void)make; (void)model; (void)transform;
+    (void)phys_width; (void)phys_height; (void)subpixel; (void)make; (void)model; (void)transform;
+    goHandleOutputGeometry((uintptr_t)data, output, x, y);
 }
 
 static void shimHandleOutputMode(void *data, struct wl_output *output, uint32_t flags,
@@ -95,3 +97,37 @@ static const struct wl_output_listener output_listener = {
 
 static inline const struct wl_output_listener *get_output_listener() { return &output_listener; }
 
+// ===== zxdg_output_v1 listener for output names and logical positions =====
+extern void goHandleXdgOutputLogicalPosition(uintptr_t handle, struct zxdg_output_v1 *xdg_output, int32_t x, int32_t y);
+extern void goHandleXdgOutputName(uintptr_t handle, struct zxdg_output_v1 *xdg_output, char *name);
+extern void goHandleXdgOutputDescription(uintptr_t handle, struct zxdg_output_v1 *xdg_output, char *description);
+
+static void shimHandleXdgOutputLogicalPosition(void *data, struct zxdg_output_v1 *xdg_output, int32_t x, int32_t y) {
+    goHandleXdgOutputLogicalPosition((uintptr_t)data, xdg_output, x, y);
+}
+
+static void shimHandleXdgOutputLogicalSize(void *data, struct zxdg_output_v1 *xdg_output, int32_t width, int32_t height) {
+    (void)data; (void)xdg_output; (void)width; (void)height;
+}
+
+static void shimHandleXdgOutputDone(void *data, struct zxdg_output_v1 *xdg_output) {
+    (void)data; (void)xdg_output;
+}
+
+static void shimHandleXdgOutputName(void *data, struct zxdg_output_v1 *xdg_output, const char *name) {
+    goHandleXdgOutputName((uintptr_t)data, xdg_output, (char *)name);
+}
+
+static void shimHandleXdgOutputDescription(void *data, struct zxdg_output_v1 *xdg_output, const char *description) {
+    goHandleXdgOutputDescription((uintptr_t)data, xdg_output, (char *)description);
+}
+
+static const struct zxdg_output_v1_listener xdg_output_listener = {
+    .logical_position = shimHandleXdgOutputLogicalPosition,
+    .logical_size     = shimHandleXdgOutputLogicalSize,
+    .done             = shimHandleXdgOutputDone,
+    .name             = shimHandleXdgOutputName,
+    .description      = shimHandleXdgOutputDescription,
+};
+
+static inline const struct zxdg_output_v1_listener *get_xdg_output_listener() { return &xdg_output_listener; }